@@ -0,0 +1,46 @@
+package authz
+
+import (
+	"context"
+	"errors"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// annotate sets Node.Permissions on every node for each of permissions, by
+// batched bulk checks rather than one RPC per node. A permission the node's
+// type does not define is left out of its map.
+func (a *Authorizer) annotate(ctx context.Context, subjectType, subjectID string, nodes []*Node, permissions []string) error {
+	if len(permissions) == 0 || len(nodes) == 0 {
+		return nil
+	}
+	subject := SubjectReference{Type: subjectType, ID: subjectID}.proto()
+	var items []*v1.CheckBulkPermissionsRequestItem
+	for _, n := range nodes {
+		for _, p := range permissions {
+			items = append(items, &v1.CheckBulkPermissionsRequestItem{
+				Resource:   ObjectReference{Type: n.Type, ID: n.ID}.proto(),
+				Permission: p,
+				Subject:    subject,
+			})
+		}
+	}
+	results, err := a.checkBulk(ctx, items)
+	if err != nil {
+		return err
+	}
+	for i, r := range results {
+		n, p := nodes[i/len(permissions)], permissions[i%len(permissions)]
+		if r.Err != nil {
+			if errors.Is(r.Err, ErrSchemaMismatch) {
+				continue
+			}
+			return r.Err
+		}
+		if n.Permissions == nil {
+			n.Permissions = map[string]Permissionship{}
+		}
+		n.Permissions[p] = r.Permissionship
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc"
+)
+
+// Authorizer talks to a single SpiceDB instance. It carries its own client,
+// logger and options, so several can live in one process and tests can hand
+// it a fake PermissionsServiceClient.
+type Authorizer struct {
+	client  v1.PermissionsServiceClient
+	schema  v1.SchemaServiceClient
+	logger  *log.Logger
+	debug   bool
+	timeout time.Duration
+
+	maxDepth          int
+	lookupConcurrency int
+	bulkCheckLimit    int
+
+	defaultConsistency Consistency
+
+	// set by Connect; nil when built around a caller-supplied client
+	conn        *grpc.ClientConn
+	dialTimeout time.Duration
+}
+
+// Option configures an Authorizer.
+type Option func(*Authorizer)
+
+// WithLogger sets the logger used for errors and debug output.
+func WithLogger(l *log.Logger) Option {
+	return func(a *Authorizer) {
+		if l != nil {
+			a.logger = l
+		}
+	}
+}
+
+// WithDebug enables the [DEBUG] trace lines emitted by the hierarchy lookups.
+func WithDebug(enabled bool) Option {
+	return func(a *Authorizer) {
+		a.debug = enabled
+	}
+}
+
+// WithTimeout sets the per-call timeout applied when the caller's context has
+// no deadline of its own. Zero disables it.
+func WithTimeout(d time.Duration) Option {
+	return func(a *Authorizer) {
+		a.timeout = d
+	}
+}
+
+// WithDefaultConsistency sets the consistency used by reads whose context
+// carries none (see WithConsistency). The default is MinimizeLatency.
+func WithDefaultConsistency(c Consistency) Option {
+	return func(a *Authorizer) {
+		a.defaultConsistency = c
+	}
+}
+
+// WithMaxDepth sets the longest parent chain writes may create and lookups
+// will follow. The default is DefaultMaxDepth; zero or less only rejects
+// cycles.
+func WithMaxDepth(n int) Option {
+	return func(a *Authorizer) {
+		a.maxDepth = n
+	}
+}
+
+// WithLookupConcurrency bounds the parent reads ListResourceHierarchy and
+// ListResourceSubtree run in parallel. The default is
+// DefaultLookupConcurrency.
+func WithLookupConcurrency(n int) Option {
+	return func(a *Authorizer) {
+		a.lookupConcurrency = n
+	}
+}
+
+// WithBulkCheckLimit sets how many checks go in one CheckBulkPermissions
+// request, for servers configured with a limit other than
+// MaxBulkCheckItems.
+func WithBulkCheckLimit(n int) Option {
+	return func(a *Authorizer) {
+		a.bulkCheckLimit = n
+	}
+}
+
+// WithSchemaClient sets the SchemaService client used by SyncSchema and
+// VerifySchema. Connect sets it automatically.
+func WithSchemaClient(c v1.SchemaServiceClient) Option {
+	return func(a *Authorizer) {
+		a.schema = c
+	}
+}
+
+// NewAuthorizer builds an Authorizer around an existing SpiceDB client. If
+// the client also serves the SchemaService (as MemoryClient does), it is used
+// for schema management too.
+func NewAuthorizer(client v1.PermissionsServiceClient, opts ...Option) *Authorizer {
+	a := &Authorizer{
+		client:  client,
+		logger:  log.New(os.Stderr, "", log.LstdFlags),
+		debug:   true,
+		timeout: DefaultTimeout,
+
+		maxDepth:          DefaultMaxDepth,
+		lookupConcurrency: DefaultLookupConcurrency,
+		bulkCheckLimit:    MaxBulkCheckItems,
+	}
+	if sc, ok := client.(v1.SchemaServiceClient); ok {
+		a.schema = sc
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// PermissionsClient returns the underlying SpiceDB client.
+func (a *Authorizer) PermissionsClient() v1.PermissionsServiceClient {
+	return a.client
+}
+
+// callContext derives the context for a single SpiceDB call. Deadlines,
+// cancellation and metadata on ctx are kept; the default timeout only applies
+// when ctx has no deadline yet.
+func (a *Authorizer) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok || a.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.timeout)
+}
+
+// errStreamIdle ends a streaming read that went quiet for longer than the
+// default timeout.
+var errStreamIdle = fmt.Errorf("no message from SpiceDB within the timeout: %w", context.DeadlineExceeded)
+
+// streamContext is callContext for a streaming read. The default timeout
+// bounds the wait for each message instead of the whole stream, so a full
+// scan that keeps making progress is not cut off part way; call alive after
+// every message. A deadline already on ctx still bounds the whole stream.
+// Pass errors from the stream through streamErr.
+func (a *Authorizer) streamContext(ctx context.Context) (stream context.Context, alive func(), cancel context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok || a.timeout <= 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, func() {}, cancel
+	}
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	idle := time.AfterFunc(a.timeout, func() { cancelCause(errStreamIdle) })
+	return ctx, func() { idle.Reset(a.timeout) }, func() {
+		idle.Stop()
+		cancelCause(context.Canceled)
+	}
+}
+
+// streamErr reports a stream cut off by streamContext's idle timeout as
+// such, rather than as the cancellation gRPC sees.
+func streamErr(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause == errStreamIdle {
+		return cause
+	}
+	return err
+}
+
+func (a *Authorizer) logf(format string, args ...interface{}) {
+	a.logger.Printf(format, args...)
+}
+
+func (a *Authorizer) debugf(format string, args ...interface{}) {
+	if a.debug {
+		a.logger.Printf("[DEBUG] "+format, args...)
+	}
+}
+
+var (
+	defaultMu         sync.RWMutex
+	defaultAuthorizer *Authorizer
+)
+
+// SetDefault replaces the Authorizer used by the package-level functions.
+func SetDefault(a *Authorizer) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultAuthorizer = a
+	if a != nil {
+		Client = a.client
+	}
+}
+
+// Default returns the Authorizer used by the package-level functions. Code
+// that still assigns Client directly keeps working: the default is rebuilt
+// around whatever client is currently set, keeping the options of the one it
+// replaces (see withClient). It is safe for concurrent use.
+func Default() *Authorizer {
+	defaultMu.RLock()
+	a := defaultAuthorizer
+	current := a != nil && a.client == Client
+	defaultMu.RUnlock()
+	if current {
+		return a
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	switch {
+	case defaultAuthorizer == nil:
+		defaultAuthorizer = NewAuthorizer(Client)
+	case defaultAuthorizer.client != Client:
+		defaultAuthorizer = defaultAuthorizer.withClient(Client)
+	}
+	return defaultAuthorizer
+}
+
+// withClient returns a copy of a, with all its options, around client. The
+// schema client is client's own if it serves the SchemaService and unset
+// otherwise, since a's belongs to the old connection. The copy does not own
+// a's connection, so closing it leaves that to a.
+func (a *Authorizer) withClient(client v1.PermissionsServiceClient) *Authorizer {
+	b := *a
+	b.client = client
+	b.schema, _ = client.(v1.SchemaServiceClient)
+	b.conn = nil
+	return &b
+}
@@ -0,0 +1,46 @@
+package authz
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDefaultConcurrent(t *testing.T) {
+	defer SetDefault(Default())
+
+	a := NewAuthorizer(NewMemoryClient(nil))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetDefault(a)
+		}()
+		go func() {
+			defer wg.Done()
+			if Default() == nil {
+				t.Error("Default() = nil")
+			}
+		}()
+	}
+	wg.Wait()
+	if got := Default(); got != a {
+		t.Errorf("Default() = %p, want the Authorizer passed to SetDefault", got)
+	}
+}
+
+func TestDefaultKeepsOptionsWhenClientChanges(t *testing.T) {
+	defer SetDefault(Default())
+
+	SetDefault(NewAuthorizer(NewMemoryClient(nil), WithTimeout(time.Second), WithMaxDepth(3), WithBulkCheckLimit(7)))
+	mc := NewMemoryClient(nil)
+	Client = mc
+	a := Default()
+	if a.client != mc || a.schema != mc {
+		t.Fatalf("Default() still uses the old client")
+	}
+	if a.timeout != time.Second || a.maxDepth != 3 || a.bulkCheckLimit != 7 {
+		t.Errorf("options lost: timeout %v, max depth %d, bulk check limit %d", a.timeout, a.maxDepth, a.bulkCheckLimit)
+	}
+}
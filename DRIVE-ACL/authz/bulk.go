@@ -0,0 +1,245 @@
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// Defaults for BulkOptions.
+const (
+	DefaultBatchSize  = 500
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 200 * time.Millisecond
+)
+
+// BulkOptions configures BulkLoad.
+type BulkOptions struct {
+	// BatchSize is the number of updates per WriteRelationships call. Keep it
+	// under SpiceDB's per-request limit (1000 by default).
+	BatchSize int
+	// MaxRetries is how often a chunk is retried after ErrUnavailable. Zero
+	// means DefaultMaxRetries; a negative value disables retries.
+	MaxRetries int
+	// Backoff is the wait before the first retry; it doubles each time.
+	Backoff time.Duration
+	// Checkpoint names a file recording how far the load got. A later
+	// BulkLoad of the same input resumes after the last written chunk; the
+	// file is removed once the load completes.
+	Checkpoint string
+	// Progress, if set, is called after each chunk is written.
+	Progress func(BulkProgress)
+}
+
+// BulkProgress describes a load in flight.
+type BulkProgress struct {
+	Chunk     int    `json:"chunk"`   // 1-based, counting from where this run started
+	Chunks    int    `json:"chunks"`  // chunks this run writes, not counting resumed ones
+	Written   int    `json:"written"` // relationships written so far, including resumed ones
+	Total     int    `json:"total"`
+	WrittenAt string `json:"zed_token"`
+}
+
+// BulkResult is what BulkLoad did.
+type BulkResult struct {
+	Written   int    `json:"written"`
+	Resumed   int    `json:"resumed"` // skipped because a checkpoint had them
+	Chunks    int    `json:"chunks"`
+	Retries   int    `json:"retries"`
+	WrittenAt string `json:"zed_token,omitempty"`
+}
+
+type bulkCheckpoint struct {
+	Input     string `json:"input"` // fingerprint of the relationship list
+	Done      int    `json:"done"`
+	WrittenAt string `json:"zed_token"`
+}
+
+func BulkLoad(rels []Relationship, opts BulkOptions) (*BulkResult, error) {
+	return BulkLoadContext(Context(), rels, opts)
+}
+
+func BulkLoadContext(ctx context.Context, rels []Relationship, opts BulkOptions) (*BulkResult, error) {
+	return Default().BulkLoad(ctx, rels, opts)
+}
+
+// BulkLoad writes rels in chunks of opts.BatchSize. Each chunk is atomic on
+// its own, so a failure leaves the earlier chunks in place. Updates are
+// TOUCHes: rerunning a load, or retrying a chunk whose response was lost, is
+// harmless. Like WriteRelationships it refuses, before writing anything, a
+// load that would create a parent cycle or exceed the depth limit.
+func (a *Authorizer) BulkLoad(ctx context.Context, rels []Relationship, opts BulkOptions) (*BulkResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+
+	// SpiceDB rejects a request that touches the same tuple twice.
+	seen := make(map[string]bool, len(rels))
+	unique := make([]Relationship, 0, len(rels))
+	for _, r := range rels {
+		if !seen[r.Key()] {
+			seen[r.Key()] = true
+			unique = append(unique, r)
+		}
+	}
+	rels = unique
+	if err := a.checkHierarchy(ctx, "bulk load", rels); err != nil {
+		return nil, err
+	}
+
+	result := &BulkResult{}
+	fingerprint := relationshipsFingerprint(rels)
+	start := 0
+	if opts.Checkpoint != "" {
+		cp, err := readCheckpoint(opts.Checkpoint)
+		switch {
+		case err != nil:
+			return nil, &Error{Op: "bulk load", Kind: ErrInvalidArgument, Err: err}
+		case cp != nil && cp.Input == fingerprint && cp.Done <= len(rels):
+			start = cp.Done
+			result.Resumed = cp.Done
+			result.WrittenAt = cp.WrittenAt
+			a.logf("bulk load: resuming after %d of %d relationships", start, len(rels))
+		case cp != nil:
+			a.logf("bulk load: checkpoint %s is for a different input, starting over", opts.Checkpoint)
+		}
+	}
+
+	// Count chunks from start: a resumed load may use a different BatchSize
+	// than the run that left the checkpoint.
+	chunks := (len(rels) - start + opts.BatchSize - 1) / opts.BatchSize
+	for off := start; off < len(rels); off += opts.BatchSize {
+		end := off + opts.BatchSize
+		if end > len(rels) {
+			end = len(rels)
+		}
+		token, retries, err := a.writeChunk(ctx, rels[off:end], opts)
+		result.Retries += retries
+		if err != nil {
+			return result, err
+		}
+		result.Written += end - off
+		result.Chunks++
+		result.WrittenAt = token
+
+		if opts.Checkpoint != "" {
+			if err := writeCheckpoint(opts.Checkpoint, bulkCheckpoint{Input: fingerprint, Done: end, WrittenAt: token}); err != nil {
+				return result, &Error{Op: "bulk load", Err: err}
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(BulkProgress{
+				Chunk:     result.Chunks,
+				Chunks:    chunks,
+				Written:   end,
+				Total:     len(rels),
+				WrittenAt: token,
+			})
+		}
+	}
+
+	if opts.Checkpoint != "" {
+		if err := os.Remove(opts.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return result, &Error{Op: "bulk load", Err: err}
+		}
+	}
+	return result, nil
+}
+
+// writeChunk writes one chunk, retrying while SpiceDB is unavailable.
+func (a *Authorizer) writeChunk(ctx context.Context, rels []Relationship, opts BulkOptions) (string, int, error) {
+	updates := make([]*v1.RelationshipUpdate, len(rels))
+	for i, r := range rels {
+		rel, err := r.Proto()
+		if err != nil {
+			return "", 0, err
+		}
+		updates[i] = &v1.RelationshipUpdate{Operation: v1.RelationshipUpdate_OPERATION_TOUCH, Relationship: rel}
+	}
+
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := a.callContext(ctx)
+		resp, err := a.client.WriteRelationships(callCtx, &v1.WriteRelationshipsRequest{Updates: updates})
+		cancel()
+		if err == nil {
+			return zedToken(resp.WrittenAt), attempt, nil
+		}
+		err = wrapErr("bulk load", err)
+		if !errors.Is(err, ErrUnavailable) || attempt >= opts.MaxRetries || ctx.Err() != nil {
+			return "", attempt, err
+		}
+		a.logf("bulk load: chunk failed, retrying in %s: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", attempt, wrapErr("bulk load", ctx.Err())
+		}
+		backoff *= 2
+	}
+}
+
+func relationshipsFingerprint(rels []Relationship) string {
+	h := sha256.New()
+	for _, r := range rels {
+		fmt.Fprintln(h, r.String())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readCheckpoint(path string) (*bulkCheckpoint, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	var cp bulkCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// writeCheckpoint replaces the file atomically so a crash mid-write never
+// leaves a torn checkpoint behind.
+func writeCheckpoint(path string, cp bulkCheckpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
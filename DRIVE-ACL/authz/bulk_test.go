@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestBulkLoadResumeWithNewBatchSize(t *testing.T) {
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("folder:f%d#viewer@user:u", i))
+	}
+	rels := parseRels(t, lines...)
+	mc := newEvalClient(t, lines[:4]...)
+	a := NewAuthorizer(mc)
+
+	// A run with BatchSize 2 got through two chunks before stopping.
+	cp := filepath.Join(t.TempDir(), "load.checkpoint")
+	if err := writeCheckpoint(cp, bulkCheckpoint{Input: relationshipsFingerprint(rels), Done: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []BulkProgress
+	res, err := a.BulkLoad(context.Background(), rels, BulkOptions{
+		BatchSize:  4,
+		Checkpoint: cp,
+		Progress:   func(p BulkProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Resumed != 4 || res.Written != 6 || res.Chunks != 2 {
+		t.Errorf("result = %+v, want 4 resumed, 6 written in 2 chunks", res)
+	}
+	want := []BulkProgress{
+		{Chunk: 1, Chunks: 2, Written: 8, Total: 10},
+		{Chunk: 2, Chunks: 2, Written: 10, Total: 10},
+	}
+	if len(progress) != len(want) {
+		t.Fatalf("progress = %+v, want %+v", progress, want)
+	}
+	for i, p := range progress {
+		p.WrittenAt = ""
+		if p != want[i] {
+			t.Errorf("progress[%d] = %+v, want %+v", i, p, want[i])
+		}
+	}
+	if n := len(storedKeys(t, mc, "folder")); n != 10 {
+		t.Errorf("%d relationships stored, want 10", n)
+	}
+}
@@ -0,0 +1,647 @@
+package authz
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caveat bodies are CEL. This is the subset schema.zed needs: literals,
+// parameters, field access, arithmetic, comparisons, "in" and the logical
+// operators, evaluated with CEL's partial-evaluation rules so that missing
+// parameters make a result conditional instead of failing it.
+
+// caveatValue is either a known value or unknown because the listed
+// parameters were not supplied.
+type caveatValue struct {
+	v       interface{}
+	missing []string
+}
+
+func (v caveatValue) known() bool { return len(v.missing) == 0 }
+
+func unknownValue(a, b caveatValue) caveatValue {
+	return caveatValue{missing: mergeMissing(a.missing, b.missing)}
+}
+
+func mergeMissing(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+type caveatExpr interface {
+	eval(env map[string]interface{}) (caveatValue, error)
+}
+
+// evalCaveat evaluates a caveat against its merged context. It returns
+// (true|false, nil, nil) when decidable, or the missing parameter names.
+// Supplied parameters must have their declared types, as SpiceDB requires:
+// a float for an int parameter is an error, not a rounded value.
+func (c *CaveatDef) evalCaveat(env map[string]interface{}) (bool, []string, error) {
+	for _, p := range c.Params {
+		if v, ok := env[p.Name]; ok {
+			if err := checkCaveatParam(p.Type, v); err != nil {
+				return false, nil, fmt.Errorf("caveat %s: parameter %s: %w", c.Name, p.Name, err)
+			}
+		}
+	}
+	v, err := c.expr.eval(env)
+	if err != nil {
+		return false, nil, fmt.Errorf("caveat %s: %w", c.Name, err)
+	}
+	if !v.known() {
+		return false, v.missing, nil
+	}
+	b, ok := v.v.(bool)
+	if !ok {
+		return false, nil, fmt.Errorf("caveat %s: expression is %T, not bool", c.Name, v.v)
+	}
+	return b, nil, nil
+}
+
+// checkCaveatParam reports whether v, as decoded from a JSON or protobuf
+// Struct context, can be a value of the caveat parameter type typ. Numbers
+// arrive as float64, so int and uint take only whole numbers; duration,
+// timestamp and ipaddress arrive as strings and must parse.
+func checkCaveatParam(typ string, v interface{}) error {
+	base, arg, generic := strings.Cut(strings.TrimSuffix(typ, ">"), "<")
+	switch base {
+	case "any":
+		return nil
+	case "bool":
+		if _, ok := v.(bool); ok {
+			return nil
+		}
+	case "string", "bytes":
+		if _, ok := v.(string); ok {
+			return nil
+		}
+	case "int", "uint", "double":
+		n, ok := normalizeCELValue(v).(float64)
+		switch {
+		case !ok:
+		case base == "double":
+			return nil
+		case n != math.Trunc(n) || math.IsInf(n, 0):
+			return fmt.Errorf("got %v, want %s", v, base)
+		case base == "uint" && n < 0:
+			return fmt.Errorf("got %v, want uint", v)
+		default:
+			return nil
+		}
+	case "duration":
+		if str, ok := v.(string); ok {
+			if _, err := time.ParseDuration(str); err != nil {
+				return fmt.Errorf("%q is not a duration", str)
+			}
+			return nil
+		}
+	case "timestamp":
+		if str, ok := v.(string); ok {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%q is not an RFC 3339 timestamp", str)
+			}
+			return nil
+		}
+	case "ipaddress":
+		if str, ok := v.(string); ok {
+			if net.ParseIP(str) == nil {
+				return fmt.Errorf("%q is not an IP address", str)
+			}
+			return nil
+		}
+	case "list":
+		if l, ok := v.([]interface{}); ok && generic {
+			for i, el := range l {
+				if err := checkCaveatParam(arg, el); err != nil {
+					return fmt.Errorf("[%d]: %w", i, err)
+				}
+			}
+			return nil
+		}
+	case "map":
+		if m, ok := v.(map[string]interface{}); ok && generic {
+			for k, el := range m {
+				if err := checkCaveatParam(arg, el); err != nil {
+					return fmt.Errorf("[%q]: %w", k, err)
+				}
+			}
+			return nil
+		}
+	default:
+		// A type this evaluator does not know; leave it to the expression.
+		return nil
+	}
+	return fmt.Errorf("got %T, want %s", v, typ)
+}
+
+// ----------------- AST -----------------
+
+type celLiteral struct{ v interface{} }
+type celIdent struct{ name string }
+type celSelect struct {
+	operand caveatExpr
+	field   string
+}
+type celIndex struct{ operand, index caveatExpr }
+type celList struct{ elems []caveatExpr }
+type celUnary struct {
+	op      string
+	operand caveatExpr
+}
+type celBinary struct {
+	op          string
+	left, right caveatExpr
+}
+
+func (e *celLiteral) eval(map[string]interface{}) (caveatValue, error) {
+	return caveatValue{v: e.v}, nil
+}
+
+func (e *celIdent) eval(env map[string]interface{}) (caveatValue, error) {
+	v, ok := env[e.name]
+	if !ok {
+		return caveatValue{missing: []string{e.name}}, nil
+	}
+	return caveatValue{v: normalizeCELValue(v)}, nil
+}
+
+func (e *celSelect) eval(env map[string]interface{}) (caveatValue, error) {
+	op, err := e.operand.eval(env)
+	if err != nil || !op.known() {
+		return op, err
+	}
+	m, ok := op.v.(map[string]interface{})
+	if !ok {
+		return caveatValue{}, fmt.Errorf("cannot select .%s from %T", e.field, op.v)
+	}
+	v, ok := m[e.field]
+	if !ok {
+		return caveatValue{}, fmt.Errorf("no such key %q", e.field)
+	}
+	return caveatValue{v: normalizeCELValue(v)}, nil
+}
+
+func (e *celIndex) eval(env map[string]interface{}) (caveatValue, error) {
+	op, err := e.operand.eval(env)
+	if err != nil {
+		return op, err
+	}
+	idx, err := e.index.eval(env)
+	if err != nil {
+		return idx, err
+	}
+	if !op.known() || !idx.known() {
+		return unknownValue(op, idx), nil
+	}
+	switch c := op.v.(type) {
+	case map[string]interface{}:
+		k, ok := idx.v.(string)
+		if !ok {
+			return caveatValue{}, fmt.Errorf("map key must be string, got %T", idx.v)
+		}
+		v, ok := c[k]
+		if !ok {
+			return caveatValue{}, fmt.Errorf("no such key %q", k)
+		}
+		return caveatValue{v: normalizeCELValue(v)}, nil
+	case []interface{}:
+		n, ok := idx.v.(float64)
+		if !ok || n < 0 || int(n) >= len(c) {
+			return caveatValue{}, fmt.Errorf("index %v out of range", idx.v)
+		}
+		return caveatValue{v: normalizeCELValue(c[int(n)])}, nil
+	}
+	return caveatValue{}, fmt.Errorf("cannot index %T", op.v)
+}
+
+func (e *celList) eval(env map[string]interface{}) (caveatValue, error) {
+	out := make([]interface{}, 0, len(e.elems))
+	var missing []string
+	for _, el := range e.elems {
+		v, err := el.eval(env)
+		if err != nil {
+			return v, err
+		}
+		missing = mergeMissing(missing, v.missing)
+		out = append(out, v.v)
+	}
+	if len(missing) > 0 {
+		return caveatValue{missing: missing}, nil
+	}
+	return caveatValue{v: out}, nil
+}
+
+func (e *celUnary) eval(env map[string]interface{}) (caveatValue, error) {
+	v, err := e.operand.eval(env)
+	if err != nil || !v.known() {
+		return v, err
+	}
+	switch e.op {
+	case "!":
+		b, ok := v.v.(bool)
+		if !ok {
+			return caveatValue{}, fmt.Errorf("! on %T", v.v)
+		}
+		return caveatValue{v: !b}, nil
+	case "-":
+		n, ok := v.v.(float64)
+		if !ok {
+			return caveatValue{}, fmt.Errorf("- on %T", v.v)
+		}
+		return caveatValue{v: -n}, nil
+	}
+	return caveatValue{}, fmt.Errorf("unknown operator %s", e.op)
+}
+
+func (e *celBinary) eval(env map[string]interface{}) (caveatValue, error) {
+	l, err := e.left.eval(env)
+	if err != nil {
+		return l, err
+	}
+	r, err := e.right.eval(env)
+	if err != nil {
+		return r, err
+	}
+
+	// && and || short-circuit on a known operand even if the other is unknown.
+	switch e.op {
+	case "&&", "||":
+		short := e.op == "||"
+		for _, side := range []caveatValue{l, r} {
+			if side.known() {
+				b, ok := side.v.(bool)
+				if !ok {
+					return caveatValue{}, fmt.Errorf("%s on %T", e.op, side.v)
+				}
+				if b == short {
+					return caveatValue{v: short}, nil
+				}
+			}
+		}
+		if !l.known() || !r.known() {
+			return unknownValue(l, r), nil
+		}
+		return caveatValue{v: !short}, nil
+	}
+
+	if !l.known() || !r.known() {
+		return unknownValue(l, r), nil
+	}
+	switch e.op {
+	case "==":
+		return caveatValue{v: celEqual(l.v, r.v)}, nil
+	case "!=":
+		return caveatValue{v: !celEqual(l.v, r.v)}, nil
+	case "in":
+		switch c := r.v.(type) {
+		case []interface{}:
+			for _, el := range c {
+				if celEqual(l.v, el) {
+					return caveatValue{v: true}, nil
+				}
+			}
+			return caveatValue{v: false}, nil
+		case map[string]interface{}:
+			k, _ := l.v.(string)
+			_, ok := c[k]
+			return caveatValue{v: ok}, nil
+		}
+		return caveatValue{}, fmt.Errorf("in on %T", r.v)
+	}
+
+	if ls, ok := l.v.(string); ok {
+		rs, ok := r.v.(string)
+		if !ok {
+			return caveatValue{}, fmt.Errorf("%s on string and %T", e.op, r.v)
+		}
+		switch e.op {
+		case "+":
+			return caveatValue{v: ls + rs}, nil
+		case "<":
+			return caveatValue{v: ls < rs}, nil
+		case "<=":
+			return caveatValue{v: ls <= rs}, nil
+		case ">":
+			return caveatValue{v: ls > rs}, nil
+		case ">=":
+			return caveatValue{v: ls >= rs}, nil
+		}
+		return caveatValue{}, fmt.Errorf("%s on strings", e.op)
+	}
+
+	ln, lok := l.v.(float64)
+	rn, rok := r.v.(float64)
+	if !lok || !rok {
+		return caveatValue{}, fmt.Errorf("%s on %T and %T", e.op, l.v, r.v)
+	}
+	switch e.op {
+	case "+":
+		return caveatValue{v: ln + rn}, nil
+	case "-":
+		return caveatValue{v: ln - rn}, nil
+	case "*":
+		return caveatValue{v: ln * rn}, nil
+	case "/":
+		if rn == 0 {
+			return caveatValue{}, fmt.Errorf("division by zero")
+		}
+		return caveatValue{v: ln / rn}, nil
+	case "%":
+		if rn == 0 {
+			return caveatValue{}, fmt.Errorf("modulus by zero")
+		}
+		return caveatValue{v: float64(int64(ln) % int64(rn))}, nil
+	case "<":
+		return caveatValue{v: ln < rn}, nil
+	case "<=":
+		return caveatValue{v: ln <= rn}, nil
+	case ">":
+		return caveatValue{v: ln > rn}, nil
+	case ">=":
+		return caveatValue{v: ln >= rn}, nil
+	}
+	return caveatValue{}, fmt.Errorf("unknown operator %s", e.op)
+}
+
+// normalizeCELValue maps Go numbers onto float64, the one numeric type the
+// evaluator works with.
+func normalizeCELValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	}
+	return v
+}
+
+func celEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeCELValue(a), normalizeCELValue(b))
+}
+
+// ----------------- parser -----------------
+
+type celParser struct {
+	toks []string
+	i    int
+}
+
+func parseCaveatExpr(src string) (caveatExpr, error) {
+	toks, err := lexCEL(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &celParser{toks: toks}
+	e, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.toks[p.i])
+	}
+	return e, nil
+}
+
+var celLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *celParser) peek() string {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return ""
+}
+
+func (p *celParser) next() string {
+	t := p.peek()
+	p.i++
+	return t
+}
+
+func (p *celParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, found %q", tok, got)
+	}
+	return nil
+}
+
+func (p *celParser) parseBinary(level int) (caveatExpr, error) {
+	if level == len(celLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		matched := false
+		for _, cand := range celLevels[level] {
+			if op == cand {
+				matched = true
+			}
+		}
+		if !matched {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &celBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *celParser) parseUnary() (caveatExpr, error) {
+	if op := p.peek(); op == "!" || op == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &celUnary{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *celParser) parsePostfix() (caveatExpr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case ".":
+			p.next()
+			field := p.next()
+			if !isCELIdent(field) {
+				return nil, fmt.Errorf("expected field name after '.', found %q", field)
+			}
+			e = &celSelect{operand: e, field: field}
+		case "[":
+			p.next()
+			idx, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &celIndex{operand: e, index: idx}
+		case "(":
+			return nil, fmt.Errorf("function calls are not supported")
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *celParser) parsePrimary() (caveatExpr, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case tok == "(":
+		e, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case tok == "[":
+		l := &celList{}
+		for p.peek() != "]" {
+			el, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			l.elems = append(l.elems, el)
+			if p.peek() == "," {
+				p.next()
+			} else if p.peek() != "]" {
+				return nil, fmt.Errorf("expected ',' or ']', found %q", p.peek())
+			}
+		}
+		p.next()
+		return l, nil
+	case tok == "true", tok == "false":
+		return &celLiteral{v: tok == "true"}, nil
+	case tok == "null":
+		return &celLiteral{v: nil}, nil
+	case tok[0] == '"' || tok[0] == '\'':
+		quoted := tok
+		if tok[0] == '\'' {
+			quoted = `"` + strings.ReplaceAll(tok[1:len(tok)-1], `"`, `\"`) + `"`
+		}
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("bad string literal %s", tok)
+		}
+		return &celLiteral{v: s}, nil
+	case tok[0] >= '0' && tok[0] <= '9':
+		n, err := strconv.ParseFloat(strings.TrimRight(tok, "uU"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %s", tok)
+		}
+		return &celLiteral{v: n}, nil
+	case isCELIdent(tok):
+		return &celIdent{name: tok}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+func isCELIdent(s string) bool {
+	if s == "" || s == "in" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func lexCEL(src string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, src[i:j+1])
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] == 'u' || src[j] == 'U') {
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		default:
+			if i+1 < len(src) {
+				two := src[i : i+2]
+				switch two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					toks = append(toks, two)
+					i += 2
+					continue
+				}
+			}
+			if strings.IndexByte("!<>+-*/%()[].,", c) < 0 {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			toks = append(toks, string(c))
+			i++
+		}
+	}
+	return toks, nil
+}
@@ -0,0 +1,91 @@
+package authz
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
+)
+
+func TestEvalCaveat(t *testing.T) {
+	s, err := ParseSchema(schema.Zed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type ctx = map[string]interface{}
+	tests := []struct {
+		caveat  string
+		env     ctx
+		want    bool
+		missing []string
+		wantErr bool
+	}{
+		{caveat: "within_window", env: ctx{"start_ts": 100, "end_ts": 200, "request_time": 150}, want: true},
+		{caveat: "within_window", env: ctx{"start_ts": 100.0, "end_ts": 200.0, "request_time": 200.0}, want: true},
+		{caveat: "within_window", env: ctx{"start_ts": 100, "end_ts": 200, "request_time": 250}, want: false},
+		{caveat: "within_window", env: ctx{"start_ts": 100, "end_ts": 200}, missing: []string{"request_time"}},
+		{caveat: "within_window", env: ctx{}, missing: []string{"end_ts", "request_time", "start_ts"}},
+		{caveat: "within_window", env: ctx{"start_ts": 100, "end_ts": 200, "request_time": 150.5}, wantErr: true},
+		{caveat: "within_window", env: ctx{"start_ts": 100, "end_ts": 200, "request_time": "150"}, wantErr: true},
+		{caveat: "within_window", env: ctx{"start_ts": true}, wantErr: true},
+
+		{caveat: "is_internal_and_enabled", env: ctx{"enabled": true, "principal_email": "example.com", "email_domain": "example.com"}, want: true},
+		{caveat: "is_internal_and_enabled", env: ctx{"enabled": true, "principal_email": "other.com", "email_domain": "example.com"}, want: false},
+		{caveat: "is_internal_and_enabled", env: ctx{"enabled": false}, want: false},
+		{caveat: "is_internal_and_enabled", env: ctx{"enabled": true, "email_domain": "example.com"}, missing: []string{"principal_email"}},
+		{caveat: "is_internal_and_enabled", env: ctx{"enabled": "yes", "principal_email": "a", "email_domain": "a"}, wantErr: true},
+		{caveat: "is_internal_and_enabled", env: ctx{"enabled": true, "principal_email": "a", "email_domain": 5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, missing, err := s.Caveats[tt.caveat].evalCaveat(tt.env)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s(%v): err = %v, want error %v", tt.caveat, tt.env, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want || !equalStrings(missing, tt.missing) {
+			t.Errorf("%s(%v) = %v, missing %v; want %v, missing %v", tt.caveat, tt.env, got, missing, tt.want, tt.missing)
+		}
+	}
+}
+
+func TestCheckCaveatParam(t *testing.T) {
+	tests := []struct {
+		typ string
+		v   interface{}
+		ok  bool
+	}{
+		{"int", float64(-3), true},
+		{"int", 1.5, false},
+		{"uint", float64(3), true},
+		{"uint", float64(-3), false},
+		{"double", 1.5, true},
+		{"string", "x", true},
+		{"string", 1.0, false},
+		{"duration", "1h30m", true},
+		{"duration", "soon", false},
+		{"timestamp", "2030-01-02T15:04:05Z", true},
+		{"timestamp", "tomorrow", false},
+		{"ipaddress", "10.0.0.1", true},
+		{"ipaddress", "10.0.0", false},
+		{"list<int>", []interface{}{1.0, 2.0}, true},
+		{"list<int>", []interface{}{1.0, 2.5}, false},
+		{"map<string>", map[string]interface{}{"a": "b"}, true},
+		{"map<string>", map[string]interface{}{"a": true}, false},
+		{"any", true, true},
+	}
+	for _, tt := range tests {
+		if err := checkCaveatParam(tt.typ, tt.v); (err == nil) != tt.ok {
+			t.Errorf("checkCaveatParam(%s, %v) = %v, want ok %v", tt.typ, tt.v, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckRejectsMistypedCaveatContext(t *testing.T) {
+	mc := newSchemaClient(t, schema.Zed, `partner:p#user@users:u[within_window:{"start_ts":100,"end_ts":200}]`)
+	_, err := evalCheck(mc, "partner:p#view@users:u", map[string]interface{}{"request_time": 150.5})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("err = %v, want InvalidArgument", err)
+	}
+}
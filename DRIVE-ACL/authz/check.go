@@ -1,28 +1,147 @@
 package authz
 
 import (
-	"log"
+	"context"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-func Check(user, objectType, objectID, permission string) bool {
-	resp, err := Client.CheckPermission(Context(), &v1.CheckPermissionRequest{
-		Resource: &v1.ObjectReference{
-			ObjectType: objectType,
-			ObjectId:   objectID,
-		},
-		Permission: permission,
-		Subject: &v1.SubjectReference{
-			Object: &v1.ObjectReference{
-				ObjectType: "users",
-				ObjectId:   user,
-			},
-		},
+func Check(user, objectType, objectID, permission string) (bool, error) {
+	return CheckContext(Context(), user, objectType, objectID, permission)
+}
+
+func CheckContext(ctx context.Context, user, objectType, objectID, permission string) (bool, error) {
+	return Default().Check(ctx, user, objectType, objectID, permission)
+}
+
+func CheckWithCaveat(user, objectType, objectID, permission string, caveatContext map[string]interface{}) (*CheckResult, error) {
+	return CheckWithCaveatContext(Context(), user, objectType, objectID, permission, caveatContext)
+}
+
+func CheckWithCaveatContext(ctx context.Context, user, objectType, objectID, permission string, caveatContext map[string]interface{}) (*CheckResult, error) {
+	return Default().CheckWithCaveat(ctx, user, objectType, objectID, permission, caveatContext)
+}
+
+func CheckSubject(resource ObjectReference, permission string, subject SubjectReference) (bool, error) {
+	return CheckSubjectContext(Context(), resource, permission, subject)
+}
+
+func CheckSubjectContext(ctx context.Context, resource ObjectReference, permission string, subject SubjectReference) (bool, error) {
+	return Default().CheckSubject(ctx, resource, permission, subject)
+}
+
+func CheckSubjectWithCaveat(resource ObjectReference, permission string, subject SubjectReference, caveatContext map[string]interface{}) (*CheckResult, error) {
+	return CheckSubjectWithCaveatContext(Context(), resource, permission, subject, caveatContext)
+}
+
+func CheckSubjectWithCaveatContext(ctx context.Context, resource ObjectReference, permission string, subject SubjectReference, caveatContext map[string]interface{}) (*CheckResult, error) {
+	return Default().CheckSubjectWithCaveat(ctx, resource, permission, subject, caveatContext)
+}
+
+// Permissionship is the three-way outcome of a caveated check.
+type Permissionship int
+
+const (
+	PermissionDenied Permissionship = iota
+	PermissionGranted
+	// PermissionConditional means a caveat could not be decided because the
+	// check did not supply all of its parameters; see CheckResult.Missing.
+	PermissionConditional
+)
+
+func (p Permissionship) String() string {
+	switch p {
+	case PermissionGranted:
+		return "granted"
+	case PermissionConditional:
+		return "conditional"
+	}
+	return "denied"
+}
+
+// MarshalText makes Permissionship encode as its name in JSON.
+func (p Permissionship) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// CheckResult is the answer to CheckWithCaveat.
+type CheckResult struct {
+	Permissionship Permissionship `json:"permissionship"`
+	// Missing lists the caveat parameters a conditional result still needs.
+	Missing   []string `json:"missing_context,omitempty"`
+	CheckedAt string   `json:"checked_at,omitempty"`
+}
+
+// Allowed reports whether permission was granted outright.
+func (r *CheckResult) Allowed() bool {
+	return r != nil && r.Permissionship == PermissionGranted
+}
+
+// Check reports whether users:<user> holds permission on objectType:objectID.
+// A denial is (false, nil); a failed call returns an error wrapping one of
+// ErrUnavailable, ErrInvalidArgument or ErrSchemaMismatch. A grant that
+// depends on a caveat counts as a denial; use CheckWithCaveat to see it.
+func (a *Authorizer) Check(ctx context.Context, user, objectType, objectID, permission string) (bool, error) {
+	return a.CheckSubject(ctx, ObjectReference{Type: objectType, ID: objectID}, permission, User(user))
+}
+
+// CheckWithCaveat is Check with caveat context: values such as request_time
+// are sent along and evaluated by the caveats on the path. If some caveat
+// parameter is still unknown the result is PermissionConditional and Missing
+// names it.
+func (a *Authorizer) CheckWithCaveat(ctx context.Context, user, objectType, objectID, permission string, caveatContext map[string]interface{}) (*CheckResult, error) {
+	return a.CheckSubjectWithCaveat(ctx, ObjectReference{Type: objectType, ID: objectID}, permission, User(user), caveatContext)
+}
+
+// CheckSubject is Check for any subject: another type such as
+// superroot:root, or a subject set such as roles:admin#user, which holds
+// permission when the set itself is granted it.
+func (a *Authorizer) CheckSubject(ctx context.Context, resource ObjectReference, permission string, subject SubjectReference) (bool, error) {
+	res, err := a.CheckSubjectWithCaveat(ctx, resource, permission, subject, nil)
+	if err != nil {
+		return false, err
+	}
+	return res.Allowed(), nil
+}
+
+// CheckSubjectWithCaveat is CheckWithCaveat for any subject.
+func (a *Authorizer) CheckSubjectWithCaveat(ctx context.Context, resource ObjectReference, permission string, subject SubjectReference, caveatContext map[string]interface{}) (*CheckResult, error) {
+	var caveatStruct *structpb.Struct
+	if len(caveatContext) > 0 {
+		var err error
+		if caveatStruct, err = structpb.NewStruct(caveatContext); err != nil {
+			return nil, &Error{Op: "check", Kind: ErrInvalidArgument, Err: err}
+		}
+	}
+
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+
+	resp, err := a.client.CheckPermission(ctx, &v1.CheckPermissionRequest{
+		Consistency: a.consistency(ctx),
+		Resource:    resource.proto(),
+		Permission:  permission,
+		Subject:     subject.proto(),
+		Context:     caveatStruct,
 	})
 	if err != nil {
-		log.Printf("failed to check: %v", err)
-		return false
+		return nil, wrapErr("check", err)
+	}
+
+	res := &CheckResult{CheckedAt: zedToken(resp.CheckedAt), Permissionship: permissionshipFromProto(resp.Permissionship)}
+	if res.Permissionship == PermissionConditional {
+		res.Missing = resp.GetPartialCaveatInfo().GetMissingRequiredContext()
+	}
+	return res, nil
+}
+
+func permissionshipFromProto(p v1.CheckPermissionResponse_Permissionship) Permissionship {
+	switch p {
+	case v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION:
+		return PermissionGranted
+	case v1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION:
+		return PermissionConditional
 	}
-	return resp.Permissionship == v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION
+	return PermissionDenied
 }
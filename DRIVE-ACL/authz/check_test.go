@@ -0,0 +1,47 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
+)
+
+func TestCheckSubject(t *testing.T) {
+	mc := newSchemaClient(t, schema.Zed,
+		"publisher:b#role@roles:admin",
+		"roles:admin#user@users:alice",
+		"partner:p#root@superroot:root",
+		"superroot:root#superadmin@users:boss",
+	)
+	a := NewAuthorizer(mc)
+	tests := []struct {
+		resource, permission, subject string
+		want                          bool
+	}{
+		// A subject set holds what is granted to the set itself.
+		{"publisher:b", "admin", "roles:admin#user", true},
+		{"publisher:b", "admin", "roles:other#user", false},
+		{"publisher:b", "admin", "users:alice", true},
+		{"partner:p", "admin", "users:boss", true},
+		// superroot:root confers admin through its superadmins; it holds none.
+		{"partner:p", "admin", "superroot:root", false},
+	}
+	for _, tt := range tests {
+		resource, err := ParseObjectReference(tt.resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subject, err := ParseSubjectReference(tt.subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := a.CheckSubject(context.Background(), resource, tt.permission, subject)
+		if err != nil {
+			t.Fatalf("%s#%s@%s: %v", tt.resource, tt.permission, tt.subject, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s#%s@%s = %v, want %v", tt.resource, tt.permission, tt.subject, got, tt.want)
+		}
+	}
+}
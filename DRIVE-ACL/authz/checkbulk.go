@@ -0,0 +1,217 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// MaxBulkCheckItems is the most checks sent in one CheckBulkPermissions
+// request by default, SpiceDB's default limit. Larger batches are split; see
+// WithBulkCheckLimit.
+const MaxBulkCheckItems = 1000
+
+// CheckItem is one check in a CheckBulk: does the subject hold Permission on
+// ObjectType:ObjectID? The subject is users:User unless SubjectType is set;
+// SubjectID, when set, takes the place of User.
+type CheckItem struct {
+	User            string `json:"user,omitempty"`
+	SubjectType     string `json:"subject_type,omitempty"`
+	SubjectID       string `json:"subject_id,omitempty"`
+	SubjectRelation string `json:"subject_relation,omitempty"`
+	ObjectType      string `json:"object_type"`
+	ObjectID        string `json:"object_id"`
+	Permission      string `json:"permission"`
+	// Context feeds caveats, e.g. {"request_time": 1700000000}.
+	Context map[string]interface{} `json:"context,omitempty"`
+}
+
+// Resource is the object the item checks.
+func (it CheckItem) Resource() ObjectReference {
+	return ObjectReference{Type: it.ObjectType, ID: it.ObjectID}
+}
+
+// Subject is the subject the item checks, as described on CheckItem.
+func (it CheckItem) Subject() SubjectReference {
+	s := SubjectReference{Type: it.SubjectType, ID: it.SubjectID, Relation: it.SubjectRelation}
+	if s.Type == "" {
+		s.Type = "users"
+	}
+	if s.ID == "" {
+		s.ID = it.User
+	}
+	return s
+}
+
+// CheckItemResult is the outcome of one CheckItem. Err is set, and
+// Permissionship is PermissionDenied, when that check alone failed, e.g.
+// for a permission the type does not define.
+type CheckItemResult struct {
+	Permissionship Permissionship `json:"permissionship"`
+	Missing        []string       `json:"missing_context,omitempty"`
+	Err            error          `json:"-"`
+}
+
+// Allowed reports whether permission was granted outright.
+func (r CheckItemResult) Allowed() bool {
+	return r.Err == nil && r.Permissionship == PermissionGranted
+}
+
+// MarshalJSON adds "allowed", as /check reports it, and Err as "error".
+func (r CheckItemResult) MarshalJSON() ([]byte, error) {
+	type plain CheckItemResult
+	out := struct {
+		Allowed bool `json:"allowed"`
+		plain
+		Error string `json:"error,omitempty"`
+	}{Allowed: r.Allowed(), plain: plain(r)}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+func CheckBulk(items []CheckItem) ([]CheckItemResult, error) {
+	return CheckBulkContext(Context(), items)
+}
+
+func CheckBulkContext(ctx context.Context, items []CheckItem) ([]CheckItemResult, error) {
+	return Default().CheckBulk(ctx, items)
+}
+
+// CheckBulk runs many checks through CheckBulkPermissions and returns one
+// result per item, in input order. Identical items are checked once, and
+// requests over the bulk check limit are split. A failing item gets its own
+// Err; the returned error is for failures of the call as a whole.
+func (a *Authorizer) CheckBulk(ctx context.Context, items []CheckItem) ([]CheckItemResult, error) {
+	reqs := make([]*v1.CheckBulkPermissionsRequestItem, len(items))
+	bad := map[int]error{}
+	for i, it := range items {
+		var caveatStruct *structpb.Struct
+		if len(it.Context) > 0 {
+			var err error
+			if caveatStruct, err = structpb.NewStruct(it.Context); err != nil {
+				bad[i] = &Error{Op: "check", Kind: ErrInvalidArgument, Err: err}
+				continue
+			}
+		}
+		reqs[i] = &v1.CheckBulkPermissionsRequestItem{
+			Resource:   it.Resource().proto(),
+			Permission: it.Permission,
+			Subject:    it.Subject().proto(),
+			Context:    caveatStruct,
+		}
+	}
+
+	var valid []*v1.CheckBulkPermissionsRequestItem
+	var at []int
+	for i, r := range reqs {
+		if r != nil {
+			valid = append(valid, r)
+			at = append(at, i)
+		}
+	}
+	checked, err := a.checkBulk(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]CheckItemResult, len(items))
+	for j, r := range checked {
+		results[at[j]] = r
+	}
+	for i, err := range bad {
+		results[i] = CheckItemResult{Err: err}
+	}
+	return results, nil
+}
+
+// checkBulk sends items in requests of at most a.bulkCheckLimit, checking
+// each distinct item once, and returns their results in order.
+func (a *Authorizer) checkBulk(ctx context.Context, items []*v1.CheckBulkPermissionsRequestItem) ([]CheckItemResult, error) {
+	index := make([]int, len(items)) // item → position in unique
+	var unique []*v1.CheckBulkPermissionsRequestItem
+	seen := map[string]int{}
+	for i, it := range items {
+		k := checkItemKey(it)
+		j, ok := seen[k]
+		if !ok {
+			j = len(unique)
+			seen[k] = j
+			unique = append(unique, it)
+		}
+		index[i] = j
+	}
+
+	limit := a.bulkCheckLimit
+	if limit <= 0 {
+		limit = MaxBulkCheckItems
+	}
+	checked := make([]CheckItemResult, len(unique))
+	for off := 0; off < len(unique); off += limit {
+		end := min(off+limit, len(unique))
+		resp, err := a.checkBulkChunk(ctx, unique[off:end])
+		if err != nil {
+			return nil, err
+		}
+		// Pairs come back in request order. An item left without one, or
+		// with an empty one, fails on its own rather than reading as denied.
+		if len(resp.Pairs) != end-off {
+			a.logf("CheckBulkPermissions answered %d items with %d pairs", end-off, len(resp.Pairs))
+		}
+		for i := range unique[off:end] {
+			var pair *v1.CheckBulkPermissionsPair
+			if i < len(resp.Pairs) {
+				pair = resp.Pairs[i]
+			}
+			switch r := pair.GetResponse().(type) {
+			case *v1.CheckBulkPermissionsPair_Item:
+				checked[off+i] = CheckItemResult{
+					Permissionship: permissionshipFromProto(r.Item.Permissionship),
+					Missing:        r.Item.GetPartialCaveatInfo().GetMissingRequiredContext(),
+				}
+			case *v1.CheckBulkPermissionsPair_Error:
+				checked[off+i] = CheckItemResult{Err: wrapErr("check", status.ErrorProto(r.Error))}
+			default:
+				checked[off+i] = CheckItemResult{Err: &Error{Op: "check", Err: errors.New("SpiceDB returned no result for this item")}}
+			}
+		}
+	}
+
+	results := make([]CheckItemResult, len(items))
+	for i, j := range index {
+		results[i] = checked[j]
+	}
+	return results, nil
+}
+
+func (a *Authorizer) checkBulkChunk(ctx context.Context, items []*v1.CheckBulkPermissionsRequestItem) (*v1.CheckBulkPermissionsResponse, error) {
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+	resp, err := a.client.CheckBulkPermissions(ctx, &v1.CheckBulkPermissionsRequest{
+		Consistency: a.consistency(ctx),
+		Items:       items,
+	})
+	if err != nil {
+		return nil, wrapErr("check bulk permissions", err)
+	}
+	return resp, nil
+}
+
+// checkItemKey identifies a check: resource, permission, subject and
+// caveat context.
+func checkItemKey(it *v1.CheckBulkPermissionsRequestItem) string {
+	k := it.GetResource().GetObjectType() + ":" + it.GetResource().GetObjectId() + "#" + it.Permission +
+		"@" + it.GetSubject().GetObject().GetObjectType() + ":" + it.GetSubject().GetObject().GetObjectId()
+	if rel := it.GetSubject().GetOptionalRelation(); rel != "" {
+		k += "#" + rel
+	}
+	if it.Context != nil {
+		b, _ := json.Marshal(it.Context.AsMap()) // map keys are sorted
+		k += string(b)
+	}
+	return k
+}
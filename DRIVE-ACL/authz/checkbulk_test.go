@@ -0,0 +1,100 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc"
+)
+
+// bulkHook records the size of each CheckBulkPermissions request and can
+// tamper with the response.
+type bulkHook struct {
+	*MemoryClient
+	sizes  []int
+	tamper func(*v1.CheckBulkPermissionsResponse)
+}
+
+func (b *bulkHook) CheckBulkPermissions(ctx context.Context, in *v1.CheckBulkPermissionsRequest, opts ...grpc.CallOption) (*v1.CheckBulkPermissionsResponse, error) {
+	b.sizes = append(b.sizes, len(in.Items))
+	resp, err := b.MemoryClient.CheckBulkPermissions(ctx, in, opts...)
+	if err == nil && b.tamper != nil {
+		b.tamper(resp)
+	}
+	return resp, err
+}
+
+func TestCheckBulk(t *testing.T) {
+	mc := newEvalClient(t,
+		"folder:a#viewer@user:u",
+		"folder:b#parent@folder:a",
+		"folder:c#reader@user:u[in_hours]",
+	)
+	hook := &bulkHook{MemoryClient: mc}
+	a := NewAuthorizer(hook, WithBulkCheckLimit(2))
+
+	item := func(id, permission string) CheckItem {
+		return CheckItem{SubjectType: "user", SubjectID: "u", ObjectType: "folder", ObjectID: id, Permission: permission}
+	}
+	items := []CheckItem{
+		item("a", "view"),
+		item("b", "view"),
+		item("a", "view"), // same as the first: checked once
+		item("c", "read"),
+		item("a", "nope"),
+		item("d", "view"),
+		item("b", "view"),
+	}
+	results, err := a.CheckBulk(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Five distinct checks, two per request.
+	if want := []int{2, 2, 1}; !equalInts(hook.sizes, want) {
+		t.Errorf("request sizes = %v, want %v", hook.sizes, want)
+	}
+	want := []Permissionship{PermissionGranted, PermissionGranted, PermissionGranted, PermissionConditional, PermissionDenied, PermissionDenied, PermissionGranted}
+	for i, r := range results {
+		if r.Permissionship != want[i] {
+			t.Errorf("item %d (%+v) = %v, want %v", i, items[i], r.Permissionship, want[i])
+		}
+		if (r.Err != nil) != (i == 4) {
+			t.Errorf("item %d err = %v", i, r.Err)
+		}
+	}
+	if !equalStrings(results[3].Missing, []string{"hour"}) {
+		t.Errorf("missing context = %v, want [hour]", results[3].Missing)
+	}
+}
+
+func TestCheckBulkMissingPairs(t *testing.T) {
+	mc := newEvalClient(t, "folder:a#viewer@user:u", "folder:b#viewer@user:u")
+	hook := &bulkHook{MemoryClient: mc, tamper: func(resp *v1.CheckBulkPermissionsResponse) {
+		resp.Pairs[0].Response = nil
+		resp.Pairs = resp.Pairs[:len(resp.Pairs)-1]
+	}}
+	results, err := NewAuthorizer(hook).CheckBulk(context.Background(), []CheckItem{
+		{SubjectType: "user", SubjectID: "u", ObjectType: "folder", ObjectID: "a", Permission: "view"},
+		{SubjectType: "user", SubjectID: "u", ObjectType: "folder", ObjectID: "b", Permission: "view"},
+		{SubjectType: "user", SubjectID: "u", ObjectType: "folder", ObjectID: "c", Permission: "view"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err == nil || results[1].Err != nil || results[2].Err == nil {
+		t.Errorf("errors = %v, %v, %v; want the empty and the missing pair to fail", results[0].Err, results[1].Err, results[2].Err)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
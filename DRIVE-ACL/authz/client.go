@@ -2,29 +2,33 @@ package authz
 
 import (
 	"context"
-	"log"
+	"time"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
-	grpcutil "github.com/authzed/grpcutil"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
+// Client is the SpiceDB client behind the package-level functions.
+//
+// Deprecated: construct an Authorizer with NewAuthorizer or Connect instead.
 var Client v1.PermissionsServiceClient
 
-func InitClient(addr, secret string) {
-	conn, err := grpc.NewClient(
-		addr,
-		grpcutil.WithInsecureBearerToken(secret),
-		grpc.WithTransportCredentials(insecure.NewCredentials()), // Allow insecure connection
-		grpc.WithBlock(),
-	)
+// DefaultTimeout bounds each SpiceDB call made without a caller deadline.
+const DefaultTimeout = 10 * time.Second
+
+// InitClient connects the default Authorizer to SpiceDB at addr over
+// plaintext with a static bearer token. Use Connect for TLS, mTLS or a
+// rotatable token.
+func InitClient(addr, secret string) error {
+	a, err := Connect(addr, WithInsecure(), WithToken(secret))
 	if err != nil {
-		log.Fatalf("failed to dial SpiceDB: %v", err)
+		return err
 	}
-	Client = v1.NewPermissionsServiceClient(conn)
+	SetDefault(a)
+	return nil
 }
 
+// Context returns the context used by the package-level functions that do not
+// take one.
 func Context() context.Context {
 	return context.Background()
 }
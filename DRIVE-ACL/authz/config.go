@@ -0,0 +1,507 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the typed form of the config Translate reads, one section per
+// definition of the embedded schema.zed. Each section maps an object id to
+// the grants on that object; the field names are the spellings Export
+// writes.
+type Config struct {
+	Roles       map[string]*RoleConfig      `json:"roles,omitempty"`
+	Superroot   map[string]*SuperrootConfig `json:"superroot,omitempty"`
+	Pages       map[string]*PageConfig      `json:"pages,omitempty"`
+	Partners    map[string]*PartnerConfig   `json:"partners,omitempty"`
+	Advertisers map[string]*AccountConfig   `json:"advertisers,omitempty"`
+	Publishers  map[string]*AccountConfig   `json:"publishers,omitempty"`
+	APIs        map[string]*APIConfig       `json:"apis,omitempty"`
+	Features    map[string]*FeatureConfig   `json:"features,omitempty"`
+}
+
+type RoleConfig struct {
+	Users  []Grant    `json:"users,omitempty"`
+	Scopes StringList `json:"scopes,omitempty"`
+}
+
+type SuperrootConfig struct {
+	Superadmin StringList `json:"superadmin,omitempty"`
+}
+
+type PageConfig struct {
+	Root        StringList `json:"root,omitempty"`
+	Roles       StringList `json:"roles,omitempty"`
+	Users       []Grant    `json:"users,omitempty"`
+	Public      Wildcard   `json:"public,omitempty"`
+	DeniedUsers StringList `json:"denied_users,omitempty"`
+}
+
+type PartnerConfig struct {
+	Root        StringList `json:"root,omitempty"`
+	Users       []Grant    `json:"users,omitempty"`
+	Roles       StringList `json:"roles,omitempty"`
+	Public      Wildcard   `json:"public,omitempty"`
+	DeniedUsers StringList `json:"denied_users,omitempty"`
+}
+
+// AccountConfig is an advertiser or a publisher.
+type AccountConfig struct {
+	Root        StringList `json:"root,omitempty"`
+	Parent      StringList `json:"parent,omitempty"`
+	Users       []Grant    `json:"users,omitempty"`
+	Roles       StringList `json:"roles,omitempty"`
+	Public      Wildcard   `json:"public,omitempty"`
+	DeniedUsers StringList `json:"denied_users,omitempty"`
+}
+
+type APIConfig struct {
+	Parent      StringList `json:"parent,omitempty"`
+	Roles       StringList `json:"roles,omitempty"`
+	Users       []Grant    `json:"users,omitempty"`
+	DeniedUsers StringList `json:"denied_users,omitempty"`
+}
+
+// FeatureConfig is a feature; its children get it as their parent.
+type FeatureConfig struct {
+	Root        StringList                `json:"root,omitempty"`
+	Parent      StringList                `json:"parent,omitempty"`
+	Users       []Grant                   `json:"users,omitempty"`
+	Roles       StringList                `json:"roles,omitempty"`
+	Public      Wildcard                  `json:"public,omitempty"`
+	DeniedUsers StringList                `json:"denied_users,omitempty"`
+	APIs        StringList                `json:"apis,omitempty"`
+	Children    map[string]*FeatureConfig `json:"children,omitempty"`
+}
+
+// StringList is written as one string or a list of strings: ids, or
+// "type:id" where the relation admits several types.
+type StringList []string
+
+// Wildcard is a public flag, written as true, "*" or ["*"].
+type Wildcard bool
+
+// Grant is a user list entry, written as "alice" or as
+// {"user": "alice", "caveat": "within_window", "context": {...},
+// "expiration": "2030-01-02T15:04:05Z"}.
+type Grant struct {
+	User       string                 `json:"user"`
+	Caveat     string                 `json:"caveat,omitempty"`
+	Context    map[string]interface{} `json:"context,omitempty"`
+	Expiration time.Time              `json:"-"`
+}
+
+// MarshalJSON writes a grant without a caveat or expiration as a plain
+// string.
+func (g Grant) MarshalJSON() ([]byte, error) {
+	if g.Caveat == "" && g.Expiration.IsZero() {
+		return json.Marshal(g.User)
+	}
+	type plain Grant
+	out := struct {
+		plain
+		Expiration string `json:"expiration,omitempty"`
+	}{plain: plain(g)}
+	if !g.Expiration.IsZero() {
+		out.Expiration = g.Expiration.Format(time.RFC3339Nano)
+	}
+	return json.Marshal(out)
+}
+
+// ConfigProblem is one thing wrong with a config.
+type ConfigProblem struct {
+	Path    string `json:"path"` // e.g. "partners.P1.users[2]"
+	Message string `json:"message"`
+}
+
+func (p ConfigProblem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// ConfigError lists every problem found while decoding a config. It matches
+// ErrInvalidArgument with errors.Is.
+type ConfigError struct {
+	File     string
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	prefix := "config"
+	if e.File != "" {
+		prefix = e.File
+	}
+	return fmt.Sprintf("%s: %d problem(s):\n%s", prefix, len(e.Problems), strings.Join(lines, "\n"))
+}
+
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+// DecodeConfig strictly converts a decoded JSON or YAML document into a
+// Config. The document is checked the way DefaultTranslator().Translate
+// checks it: unknown sections and keys, values of the wrong type, subjects
+// the schema does not admit and parent cycles are all reported with their
+// path in a *ConfigError, and nothing is decoded.
+func DecodeConfig(m map[string]interface{}) (*Config, error) {
+	c, problems := decodeConfig(m)
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return c, nil
+}
+
+// ParseConfigJSON decodes a JSON config strictly.
+func ParseConfigJSON(data []byte) (*Config, error) {
+	doc, err := parseDocument(data, ".json")
+	if err != nil {
+		return nil, err
+	}
+	return DecodeConfig(doc)
+}
+
+// ParseConfigYAML decodes a YAML config strictly.
+func ParseConfigYAML(data []byte) (*Config, error) {
+	doc, err := parseDocument(data, ".yaml")
+	if err != nil {
+		return nil, err
+	}
+	return DecodeConfig(doc)
+}
+
+// LoadConfigFile reads a .json, .yaml or .yml config.
+func LoadConfigFile(path string) (*Config, error) {
+	doc, err := LoadConfigDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := DecodeConfig(doc)
+	if cerr, ok := err.(*ConfigError); ok {
+		cerr.File = path
+	}
+	return c, err
+}
+
+// LoadConfigDocument reads a .json, .yaml or .yml config without decoding it
+// into a Config, for a Translator.
+func LoadConfigDocument(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &Error{Op: "load config", Err: err}
+	}
+	doc, err := parseDocument(data, strings.ToLower(filepath.Ext(path)))
+	if e, ok := err.(*Error); ok {
+		e.Err = fmt.Errorf("%s: %w", path, e.Err)
+	}
+	return doc, err
+}
+
+func parseDocument(data []byte, ext string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	var err error
+	switch ext {
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		err = fmt.Errorf("want a .json, .yaml or .yml file, not %q", ext)
+	}
+	if err != nil {
+		return nil, &Error{Op: "parse config", Kind: ErrInvalidArgument, Err: err}
+	}
+	return doc, nil
+}
+
+// Translate turns c into relationships against the embedded schema; see
+// Translator.Translate. Use a Translator directly for another schema.
+func (c *Config) Translate() ([]TranslatedRelationship, error) {
+	return DefaultTranslator().Translate(c.Document())
+}
+
+// Document converts c to the generic form a Translator reads.
+func (c *Config) Document() map[string]interface{} {
+	var doc map[string]interface{}
+	if b, err := json.Marshal(c); err == nil {
+		json.Unmarshal(b, &doc)
+	}
+	return doc
+}
+
+// decodeConfig leaves validation to the translator, which knows the schema,
+// and then fills in the structs. The singular spellings the translator
+// accepts ("user" for "users") decode into the same fields.
+func decodeConfig(m map[string]interface{}) (*Config, []ConfigProblem) {
+	if _, problems := DefaultTranslator().walk(m); len(problems) > 0 {
+		return nil, problems
+	}
+	d := &configDecoder{}
+	c := &Config{}
+	d.decode("", m, reflect.ValueOf(c).Elem())
+	if len(d.problems) > 0 {
+		return nil, d.problems
+	}
+	return c, nil
+}
+
+var (
+	stringListType = reflect.TypeOf(StringList(nil))
+	wildcardType   = reflect.TypeOf(Wildcard(false))
+	grantsType     = reflect.TypeOf([]Grant(nil))
+)
+
+type configDecoder struct {
+	problems []ConfigProblem
+}
+
+func (d *configDecoder) problemf(path, format string, args ...interface{}) {
+	d.problems = append(d.problems, ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// decode stores in into out, which is a field of a Config or one of its
+// section types.
+func (d *configDecoder) decode(path string, in interface{}, out reflect.Value) {
+	switch out.Type() {
+	case stringListType:
+		out.Set(reflect.ValueOf(d.stringList(path, in)))
+		return
+	case wildcardType:
+		out.SetBool(bool(d.wildcard(path, in)))
+		return
+	case grantsType:
+		out.Set(reflect.ValueOf(d.grants(path, in)))
+		return
+	}
+
+	switch out.Kind() {
+	case reflect.Ptr:
+		out.Set(reflect.New(out.Type().Elem()))
+		d.decode(path, in, out.Elem())
+	case reflect.Map:
+		obj, ok := d.object(path, in)
+		if !ok {
+			return
+		}
+		out.Set(reflect.MakeMapWithSize(out.Type(), len(obj)))
+		for _, k := range sortedObjectKeys(obj) {
+			v := reflect.New(out.Type().Elem()).Elem()
+			d.decode(join(path, k), obj[k], v)
+			out.SetMapIndex(reflect.ValueOf(k), v)
+		}
+	case reflect.Struct:
+		obj, ok := d.object(path, in)
+		if !ok {
+			return
+		}
+		fields := map[string]int{}
+		var names []string
+		for i := 0; i < out.NumField(); i++ {
+			name, _, _ := strings.Cut(out.Type().Field(i).Tag.Get("json"), ",")
+			fields[name] = i
+			names = append(names, name)
+		}
+		for _, k := range sortedObjectKeys(obj) {
+			i, ok := fields[k]
+			if !ok {
+				i, ok = fields[plural(k)]
+			}
+			if !ok {
+				d.problemf(join(path, k), "unknown field (want one of %s)", strings.Join(names, ", "))
+				continue
+			}
+			d.decode(join(path, k), obj[k], out.Field(i))
+		}
+	default:
+		panic("authz: no config decoding for " + out.Type().String())
+	}
+}
+
+// object accepts a mapping; null stands for an empty one, as YAML writes
+// "P1:" with nothing under it.
+func (d *configDecoder) object(path string, in interface{}) (map[string]interface{}, bool) {
+	switch v := in.(type) {
+	case nil:
+		return map[string]interface{}{}, true
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			obj[fmt.Sprint(k)] = e
+		}
+		return obj, true
+	}
+	d.problemf(path, "expected an object, got %s", describe(in))
+	return nil, false
+}
+
+func (d *configDecoder) stringList(path string, in interface{}) StringList {
+	var items []interface{}
+	switch v := in.(type) {
+	case nil:
+		return nil
+	case string:
+		items = []interface{}{v}
+	case []interface{}:
+		items = v
+	default:
+		d.problemf(path, "expected a string or a list of strings, got %s", describe(in))
+		return nil
+	}
+	var out StringList
+	for i, e := range items {
+		s, ok := e.(string)
+		if !ok || s == "" {
+			d.problemf(fmt.Sprintf("%s[%d]", path, i), "expected a string, got %s", describe(e))
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (d *configDecoder) wildcard(path string, in interface{}) Wildcard {
+	switch v := in.(type) {
+	case nil:
+		return false
+	case bool:
+		return Wildcard(v)
+	case string:
+		if v == "*" {
+			return true
+		}
+	case []interface{}:
+		for _, e := range v {
+			if e != "*" {
+				d.problemf(path, `expected true, "*" or ["*"], got %s`, describe(in))
+				break
+			}
+		}
+		return len(v) > 0 && v[0] == "*"
+	}
+	d.problemf(path, `expected true, "*" or ["*"], got %s`, describe(in))
+	return false
+}
+
+func (d *configDecoder) grants(path string, in interface{}) []Grant {
+	items, isList := in.([]interface{})
+	if !isList {
+		if in == nil {
+			return nil
+		}
+		items = []interface{}{in}
+	}
+	var out []Grant
+	for i, e := range items {
+		p := path
+		if isList {
+			p = fmt.Sprintf("%s[%d]", path, i)
+		}
+		switch v := e.(type) {
+		case string:
+			if v == "" {
+				d.problemf(p, "empty user")
+				continue
+			}
+			out = append(out, Grant{User: v})
+		case map[string]interface{}:
+			if g, ok := d.grant(p, v); ok {
+				out = append(out, g)
+			}
+		default:
+			d.problemf(p, "expected a user id or a {user, caveat, context} object, got %s", describe(e))
+		}
+	}
+	return out
+}
+
+func (d *configDecoder) grant(path string, obj map[string]interface{}) (Grant, bool) {
+	var g Grant
+	ok := true
+	for _, k := range sortedObjectKeys(obj) {
+		v := obj[k]
+		var good bool
+		switch k {
+		case "user", "subject":
+			g.User, good = v.(string)
+		case "caveat":
+			g.Caveat, good = v.(string)
+		case "context":
+			g.Context, good = v.(map[string]interface{})
+		case "expiration":
+			var text string
+			if text, good = v.(string); good {
+				var err error
+				if g.Expiration, err = time.Parse(time.RFC3339, text); err != nil {
+					d.problemf(join(path, k), "want an RFC 3339 time: %v", err)
+					ok = false
+				}
+			}
+		default:
+			d.problemf(join(path, k), "unknown field (want one of user, caveat, context, expiration)")
+			ok = false
+			continue
+		}
+		if !good {
+			d.problemf(join(path, k), "unexpected %s", describe(v))
+			ok = false
+		}
+	}
+	if g.User == "" {
+		d.problemf(path, "missing user")
+		ok = false
+	}
+	if g.Context != nil && g.Caveat == "" {
+		d.problemf(join(path, "context"), "context without a caveat")
+		g.Context = nil
+	}
+	return g, ok
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describe(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string %q", t)
+	case bool:
+		return fmt.Sprintf("bool %t", t)
+	case float64, int, int64, uint64, json.Number:
+		return fmt.Sprintf("number %v", t)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func sortedObjectKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,183 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const configTestJSON = `{
+  "superroot": {"root": {"superadmin": ["boss"]}},
+  "roles": {"admin": {"users": ["alice", {"user": "bob", "caveat": "within_window", "context": {"start_ts": 1, "end_ts": 2}}], "scopes": ["partner:P1"]}},
+  "partners": {"P1": {"root": "root", "users": ["carol"], "roles": ["admin"], "public": true}},
+  "advertisers": {"A1": {"parent": "P1", "users": ["dave"], "denied_users": ["eve"]}},
+  "publishers": {"B1": {"parent": "P1"}},
+  "pages": {"PG": {"users": ["alice"]}},
+  "apis": {"X": {"parent": "F1", "users": ["alice"]}},
+  "features": {"F1": {"parent": "advertiser:A1", "apis": ["X"], "children": {"F2": {"users": ["alice"]}}}}
+}`
+
+func TestDecodeConfig(t *testing.T) {
+	doc, err := parseDocument([]byte(configTestJSON), ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeConfig(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Roles["admin"].Users[1]; got.User != "bob" || got.Caveat != "within_window" || got.Context["end_ts"] != float64(2) {
+		t.Errorf("caveated grant = %+v", got)
+	}
+	if !bool(c.Partners["P1"].Public) || c.Features["F1"].Children["F2"] == nil || !reflect.DeepEqual(c.Features["F1"].APIs, StringList{"X"}) {
+		t.Errorf("partner or feature not decoded: %+v %+v", c.Partners["P1"], c.Features["F1"])
+	}
+
+	// The typed model translates exactly as the document does.
+	typed, err := c.Translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := DefaultTranslator().Translate(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := relationshipStrings(typed), relationshipStrings(direct); !reflect.DeepEqual(got, want) {
+		t.Errorf("typed translation\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestGrantJSON(t *testing.T) {
+	exp := time.Date(2030, 1, 2, 15, 4, 5, 5e8, time.UTC)
+	tests := []struct {
+		grant Grant
+		want  string
+	}{
+		{Grant{User: "alice"}, `"alice"`},
+		{Grant{User: "alice", Caveat: "within_window", Context: map[string]interface{}{"start_ts": 1}}, `{"user":"alice","caveat":"within_window","context":{"start_ts":1}}`},
+		{Grant{User: "alice", Expiration: exp}, `{"user":"alice","expiration":"2030-01-02T15:04:05.5Z"}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(tt.grant)
+		if err != nil || string(b) != tt.want {
+			t.Errorf("Marshal(%+v) = %s, %v; want %s", tt.grant, b, err, tt.want)
+			continue
+		}
+		var d configDecoder
+		got := d.grants("g", []interface{}{mustJSON(t, b)})
+		if len(d.problems) > 0 || len(got) != 1 || got[0].User != "alice" || !got[0].Expiration.Equal(tt.grant.Expiration) {
+			t.Errorf("%s decodes to %+v, %v", b, got, d.problems)
+		}
+	}
+}
+
+func mustJSON(t *testing.T, b []byte) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDecodeConfigSingularSpellings(t *testing.T) {
+	c, err := DecodeConfig(map[string]interface{}{
+		"partners": map[string]interface{}{"P1": map[string]interface{}{"user": "alice", "denied_user": "eve"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := c.Partners["P1"]; len(p.Users) != 1 || p.Users[0].User != "alice" || !reflect.DeepEqual(p.DeniedUsers, StringList{"eve"}) {
+		t.Errorf("partner = %+v", p)
+	}
+}
+
+func TestDecodeConfigProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		path string
+	}{
+		{name: "number as user", yaml: "partners:\n  P1:\n    users: [1]\n", path: "partners.P1.users[0]"},
+		{name: "unknown key", yaml: "partners:\n  P1:\n    global: true\n", path: "partners.P1.global"},
+		{name: "unknown section", yaml: "globaluser:\n  g: {}\n", path: "globaluser"},
+		{name: "subject type not allowed", yaml: "advertisers:\n  A1:\n    parent: feature:F1\n", path: "advertisers.A1.parent"},
+		{name: "bad expiration", yaml: "partners:\n  P1:\n    users: [{user: alice, expiration: soon}]\n", path: "partners.P1.users[0].expiration"},
+		{name: "parent cycle", yaml: "features:\n  F1: {parent: feature:F2}\n  F2: {parent: feature:F1}\n", path: "features.F1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfigYAML([]byte(tt.yaml))
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) || !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("err = %v, want a *ConfigError", err)
+			}
+			if cerr.Problems[0].Path != tt.path {
+				t.Errorf("problems = %v, want one at %s", cerr.Problems, tt.path)
+			}
+
+			doc, _ := parseDocument([]byte(tt.yaml), ".yaml")
+			if rels, err := Translate(doc); err == nil {
+				t.Errorf("Translate = %v with no error", rels)
+			}
+		})
+	}
+}
+
+// TestConfigMatchesSchema keeps the structs in step with schema.zed: every
+// section and key the translator reads has a field, and nothing else does.
+func TestConfigMatchesSchema(t *testing.T) {
+	tr := DefaultTranslator()
+	sections := map[string]reflect.Type{}
+	ct := reflect.TypeOf(Config{})
+	for i := 0; i < ct.NumField(); i++ {
+		name, _, _ := strings.Cut(ct.Field(i).Tag.Get("json"), ",")
+		sections[name] = ct.Field(i).Type.Elem().Elem()
+	}
+	for _, def := range tr.ResourceTypes() {
+		st, ok := sections[sectionName(def)]
+		if !ok {
+			t.Errorf("Config has no %s section", sectionName(def))
+			continue
+		}
+		delete(sections, sectionName(def))
+		var fields []string
+		for i := 0; i < st.NumField(); i++ {
+			name, _, _ := strings.Cut(st.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+		if want := tr.keyNames(tr.schema.Definitions[def]); !sameSet(fields, want) {
+			t.Errorf("%s fields = %v, want %v", st.Name(), fields, want)
+		}
+	}
+	for name := range sections {
+		t.Errorf("Config section %s is not in the schema", name)
+	}
+}
+
+func relationshipStrings(tr []TranslatedRelationship) []string {
+	out := make([]string, len(tr))
+	for i, r := range tr {
+		out[i] = r.Relationship.String()
+	}
+	return out
+}
+
+func sameSet(a, b []string) bool {
+	m := map[string]int{}
+	for _, s := range a {
+		m[s]++
+	}
+	for _, s := range b {
+		m[s]--
+	}
+	for _, n := range m {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
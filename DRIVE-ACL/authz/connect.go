@@ -0,0 +1,293 @@
+package authz
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// DefaultDialTimeout bounds Ready when the caller's context has no deadline.
+const DefaultDialTimeout = 5 * time.Second
+
+// ClientOption configures the connection built by Connect.
+type ClientOption func(*clientConfig)
+
+type clientConfig struct {
+	token      string
+	tokenFile  string
+	tokenEnv   string
+	insecure   bool
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+
+	keepalive   *keepalive.ClientParameters
+	dialTimeout time.Duration
+	grpcOpts    []grpc.DialOption
+	authzOpts   []Option
+}
+
+// WithToken authenticates with a fixed bearer token.
+func WithToken(token string) ClientOption {
+	return func(c *clientConfig) { c.token = token }
+}
+
+// WithTokenFile reads the bearer token from path. The file is re-read whenever
+// it changes, so the token can be rotated without a restart.
+func WithTokenFile(path string) ClientOption {
+	return func(c *clientConfig) { c.tokenFile = path }
+}
+
+// WithTokenEnv reads the bearer token from the named environment variable on
+// every call.
+func WithTokenEnv(name string) ClientOption {
+	return func(c *clientConfig) { c.tokenEnv = name }
+}
+
+// WithInsecure connects over plaintext. Only meant for local development.
+func WithInsecure() ClientOption {
+	return func(c *clientConfig) { c.insecure = true }
+}
+
+// WithCACert trusts the PEM-encoded CA bundle at path instead of the system roots.
+func WithCACert(path string) ClientOption {
+	return func(c *clientConfig) { c.caFile = path }
+}
+
+// WithClientCert presents a client certificate for mTLS.
+func WithClientCert(certFile, keyFile string) ClientOption {
+	return func(c *clientConfig) {
+		c.certFile = certFile
+		c.keyFile = keyFile
+	}
+}
+
+// WithServerName overrides the name verified against the server certificate.
+func WithServerName(name string) ClientOption {
+	return func(c *clientConfig) { c.serverName = name }
+}
+
+// WithKeepalive pings the server after interval of inactivity and drops the
+// connection if no ack arrives within timeout.
+func WithKeepalive(interval, timeout time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.keepalive = &keepalive.ClientParameters{
+			Time:                interval,
+			Timeout:             timeout,
+			PermitWithoutStream: true,
+		}
+	}
+}
+
+// WithDialTimeout bounds how long Ready waits for the connection.
+func WithDialTimeout(d time.Duration) ClientOption {
+	return func(c *clientConfig) { c.dialTimeout = d }
+}
+
+// WithGRPCOptions appends raw gRPC dial options.
+func WithGRPCOptions(opts ...grpc.DialOption) ClientOption {
+	return func(c *clientConfig) { c.grpcOpts = append(c.grpcOpts, opts...) }
+}
+
+// WithAuthorizerOptions passes options through to the Authorizer Connect builds.
+func WithAuthorizerOptions(opts ...Option) ClientOption {
+	return func(c *clientConfig) { c.authzOpts = append(c.authzOpts, opts...) }
+}
+
+// Connect builds an Authorizer for the SpiceDB instance at addr. The
+// connection is established lazily on first use; call Ready to probe it.
+func Connect(addr string, opts ...ClientOption) (*Authorizer, error) {
+	cfg := &clientConfig{dialTimeout: DefaultDialTimeout}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	dialOpts, err := cfg.dialOptions()
+	if err != nil {
+		return nil, &Error{Op: "configure spicedb client", Kind: ErrInvalidArgument, Err: err}
+	}
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, &Error{Op: "dial spicedb", Kind: ErrInvalidArgument, Err: err}
+	}
+
+	a := NewAuthorizer(v1.NewPermissionsServiceClient(conn), cfg.authzOpts...)
+	if a.schema == nil {
+		a.schema = v1.NewSchemaServiceClient(conn)
+	}
+	a.conn = conn
+	a.dialTimeout = cfg.dialTimeout
+	return a, nil
+}
+
+func (c *clientConfig) dialOptions() ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+
+	if c.insecure {
+		if c.caFile != "" || c.certFile != "" {
+			return nil, errors.New("TLS certificates given together with WithInsecure")
+		}
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		tlsCfg, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+	}
+
+	if c.token != "" || c.tokenFile != "" || c.tokenEnv != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(&bearerToken{
+			static:     c.token,
+			file:       c.tokenFile,
+			env:        c.tokenEnv,
+			requireTLS: !c.insecure,
+		}))
+	}
+	if c.keepalive != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*c.keepalive))
+	}
+	return append(opts, c.grpcOpts...), nil
+}
+
+func (c *clientConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.serverName,
+	}
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.certFile != "" || c.keyFile != "" {
+		if c.certFile == "" || c.keyFile == "" {
+			return nil, errors.New("client certificate needs both cert and key files")
+		}
+		cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// bearerToken attaches "authorization: Bearer <token>" to every call. A token
+// file wins over an env var, which wins over a static token.
+type bearerToken struct {
+	static     string
+	file       string
+	env        string
+	requireTLS bool
+
+	mu      sync.Mutex
+	cached  string
+	modTime time.Time
+}
+
+func (b *bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := b.token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+func (b *bearerToken) RequireTransportSecurity() bool {
+	return b.requireTLS
+}
+
+func (b *bearerToken) token() (string, error) {
+	if b.file != "" {
+		return b.fromFile()
+	}
+	if b.env != "" {
+		if v := strings.TrimSpace(os.Getenv(b.env)); v != "" {
+			return v, nil
+		}
+		if b.static == "" {
+			return "", fmt.Errorf("bearer token env var %s is empty", b.env)
+		}
+	}
+	return b.static, nil
+}
+
+func (b *bearerToken) fromFile() (string, error) {
+	info, err := os.Stat(b.file)
+	if err != nil {
+		return "", fmt.Errorf("stat token file: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cached != "" && info.ModTime().Equal(b.modTime) {
+		return b.cached, nil
+	}
+	raw, err := os.ReadFile(b.file)
+	if err != nil {
+		return "", fmt.Errorf("read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", b.file)
+	}
+	b.cached, b.modTime = token, info.ModTime()
+	return token, nil
+}
+
+// Ready connects (if not already connected) and waits until the connection is
+// usable, the context ends, or the dial timeout passes. Authorizers built
+// around a caller-supplied client are always considered ready.
+func (a *Authorizer) Ready(ctx context.Context) error {
+	if a.conn == nil {
+		return nil
+	}
+	if _, ok := ctx.Deadline(); !ok && a.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.dialTimeout)
+		defer cancel()
+	}
+
+	a.conn.Connect()
+	for {
+		state := a.conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return &Error{Op: "probe spicedb", Kind: ErrUnavailable, Err: errors.New("connection closed")}
+		}
+		if !a.conn.WaitForStateChange(ctx, state) {
+			return &Error{Op: "probe spicedb", Kind: ErrUnavailable, Err: fmt.Errorf("connection %s: %w", state, ctx.Err())}
+		}
+	}
+}
+
+// Close releases the connection opened by Connect.
+func (a *Authorizer) Close() error {
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.Close()
+}
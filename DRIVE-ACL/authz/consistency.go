@@ -0,0 +1,114 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// Consistency modes accepted by ParseConsistency.
+const (
+	ConsistencyMinimizeLatency = "minimize_latency"
+	ConsistencyAtLeastAsFresh  = "at_least_as_fresh"
+	ConsistencyFullyConsistent = "fully_consistent"
+)
+
+// Consistency selects how fresh the data behind a read must be.
+type Consistency struct {
+	mode  string
+	token string
+}
+
+// MinimizeLatency lets SpiceDB answer from whatever snapshot is cheapest.
+func MinimizeLatency() Consistency {
+	return Consistency{mode: ConsistencyMinimizeLatency}
+}
+
+// AtLeastAsFresh requires data at least as new as the ZedToken returned by a
+// write. An empty token falls back to MinimizeLatency.
+func AtLeastAsFresh(token string) Consistency {
+	if token == "" {
+		return MinimizeLatency()
+	}
+	return Consistency{mode: ConsistencyAtLeastAsFresh, token: token}
+}
+
+// FullyConsistent reads the newest data, at the cost of bypassing caches.
+func FullyConsistent() Consistency {
+	return Consistency{mode: ConsistencyFullyConsistent}
+}
+
+// ParseConsistency builds a Consistency from a mode name and optional token.
+// An empty mode means at_least_as_fresh when a token is given and
+// minimize_latency otherwise.
+func ParseConsistency(mode, token string) (Consistency, error) {
+	switch mode {
+	case "":
+		return AtLeastAsFresh(token), nil
+	case ConsistencyMinimizeLatency:
+		return MinimizeLatency(), nil
+	case ConsistencyAtLeastAsFresh:
+		if token == "" {
+			return Consistency{}, &Error{Op: "parse consistency", Kind: ErrInvalidArgument, Err: fmt.Errorf("%s needs a zed token", mode)}
+		}
+		return AtLeastAsFresh(token), nil
+	case ConsistencyFullyConsistent:
+		return FullyConsistent(), nil
+	}
+	return Consistency{}, &Error{Op: "parse consistency", Kind: ErrInvalidArgument, Err: fmt.Errorf("unknown consistency mode %q", mode)}
+}
+
+// Mode returns the consistency mode name.
+func (c Consistency) Mode() string {
+	if c.mode == "" {
+		return ConsistencyMinimizeLatency
+	}
+	return c.mode
+}
+
+// Token returns the ZedToken for at_least_as_fresh, or "".
+func (c Consistency) Token() string {
+	return c.token
+}
+
+func (c Consistency) proto() *v1.Consistency {
+	switch c.mode {
+	case ConsistencyAtLeastAsFresh:
+		return &v1.Consistency{Requirement: &v1.Consistency_AtLeastAsFresh{
+			AtLeastAsFresh: &v1.ZedToken{Token: c.token},
+		}}
+	case ConsistencyFullyConsistent:
+		return &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}}
+	}
+	return &v1.Consistency{Requirement: &v1.Consistency_MinimizeLatency{MinimizeLatency: true}}
+}
+
+type consistencyKey struct{}
+
+// WithConsistency returns a context whose reads use c.
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// ConsistencyFromContext returns the consistency set by WithConsistency.
+func ConsistencyFromContext(ctx context.Context) (Consistency, bool) {
+	c, ok := ctx.Value(consistencyKey{}).(Consistency)
+	return c, ok
+}
+
+// consistency picks the requirement for a read: the context wins over the
+// Authorizer default.
+func (a *Authorizer) consistency(ctx context.Context) *v1.Consistency {
+	if c, ok := ConsistencyFromContext(ctx); ok {
+		return c.proto()
+	}
+	return a.defaultConsistency.proto()
+}
+
+func zedToken(t *v1.ZedToken) string {
+	if t == nil {
+		return ""
+	}
+	return t.Token
+}
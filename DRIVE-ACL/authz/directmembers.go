@@ -2,16 +2,27 @@ package authz
 
 import (
 	"context"
-	"fmt"
 	"io"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 )
 
 func GetDirectSubjects(resourceType, resourceID, relation, subjectType string) ([]string, error) {
-	ctx := context.Background()
+	return GetDirectSubjectsContext(Context(), resourceType, resourceID, relation, subjectType)
+}
+
+func GetDirectSubjectsContext(ctx context.Context, resourceType, resourceID, relation, subjectType string) ([]string, error) {
+	return Default().GetDirectSubjects(ctx, resourceType, resourceID, relation, subjectType)
+}
+
+// GetDirectSubjects returns the subjects written directly on a relation, without
+// following any permission.
+func (a *Authorizer) GetDirectSubjects(ctx context.Context, resourceType, resourceID, relation, subjectType string) ([]string, error) {
+	ctx, alive, cancel := a.streamContext(ctx)
+	defer cancel()
 
-	resp, err := Client.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
+	resp, err := a.client.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
+		Consistency: a.consistency(ctx),
 		RelationshipFilter: &v1.RelationshipFilter{
 			ResourceType:       resourceType,
 			OptionalResourceId: resourceID,
@@ -22,7 +33,7 @@ func GetDirectSubjects(resourceType, resourceID, relation, subjectType string) (
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read relationships: %w", err)
+		return nil, wrapErr("read relationships", streamErr(ctx, err))
 	}
 
 	var subjects []string
@@ -32,8 +43,9 @@ func GetDirectSubjects(resourceType, resourceID, relation, subjectType string) (
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("recv failed: %w", err)
+			return nil, wrapErr("read relationships", streamErr(ctx, err))
 		}
+		alive()
 		if rel.Relationship != nil && rel.Relationship.Subject != nil {
 			subjects = append(subjects, rel.Relationship.Subject.Object.ObjectId)
 		}
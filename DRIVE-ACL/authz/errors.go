@@ -0,0 +1,112 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Sentinel errors returned (wrapped) by authz operations. Match them with
+// errors.Is; the original gRPC error stays reachable through errors.Unwrap.
+var (
+	// ErrUnavailable means SpiceDB could not be reached or did not answer in time.
+	ErrUnavailable = errors.New("spicedb unavailable")
+	// ErrInvalidArgument means the request itself was malformed.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrSchemaMismatch means the request names a type, relation or permission
+	// the deployed schema does not define, or violates its subject types.
+	ErrSchemaMismatch = errors.New("schema mismatch")
+	// ErrAlreadyExists means a CREATE hit a relationship that is already stored.
+	ErrAlreadyExists = errors.New("relationship already exists")
+	// ErrConflict means a write's preconditions failed: someone else changed
+	// the relationships it was planned against.
+	ErrConflict = errors.New("concurrent modification")
+	// ErrCanceled means the caller gave up: its context was canceled before
+	// SpiceDB answered.
+	ErrCanceled = errors.New("canceled")
+)
+
+// errorDomain is the ErrorInfo domain SpiceDB reports its reasons under.
+const errorDomain = "authzed.com"
+
+// Error is a failed authz operation.
+type Error struct {
+	Op   string // operation that failed, e.g. "check" or "write relationships"
+	Kind error  // one of the sentinels above, or nil when unclassified
+	Err  error  // underlying error
+}
+
+func (e *Error) Error() string {
+	if e.Kind != nil {
+		return fmt.Sprintf("%s: %v: %v", e.Op, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is lets errors.Is match the sentinel kind as well as the wrapped error.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// wrapErr classifies err by its gRPC status code (or context error) and wraps it.
+func wrapErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ae *Error
+	if errors.As(err, &ae) {
+		return err
+	}
+	return &Error{Op: op, Kind: kindOf(err), Err: err}
+}
+
+func kindOf(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrUnavailable
+	}
+	switch reasonOf(err) {
+	case v1.ErrorReason_ERROR_REASON_WRITE_OR_DELETE_PRECONDITION_FAILURE:
+		return ErrConflict
+	case v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION,
+		v1.ErrorReason_ERROR_REASON_UNKNOWN_RELATION_OR_PERMISSION,
+		v1.ErrorReason_ERROR_REASON_UNKNOWN_CAVEAT:
+		return ErrSchemaMismatch
+	}
+	switch status.Code(err) {
+	case codes.Canceled:
+		return ErrCanceled
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return ErrUnavailable
+	case codes.InvalidArgument, codes.OutOfRange:
+		return ErrInvalidArgument
+	case codes.AlreadyExists:
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// reasonOf returns the SpiceDB ErrorInfo reason attached to a gRPC error, or
+// ERROR_REASON_UNSPECIFIED when it carries none. FailedPrecondition and
+// NotFound cover several unrelated failures; the reason tells them apart.
+func reasonOf(err error) v1.ErrorReason {
+	st, ok := status.FromError(err)
+	if !ok {
+		return v1.ErrorReason_ERROR_REASON_UNSPECIFIED
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == errorDomain {
+			return v1.ErrorReason(v1.ErrorReason_value[info.Reason])
+		}
+	}
+	return v1.ErrorReason_ERROR_REASON_UNSPECIFIED
+}
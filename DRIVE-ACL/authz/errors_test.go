@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestKindOf(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"context canceled", fmt.Errorf("read: %w", context.Canceled), ErrCanceled},
+		{"grpc canceled", status.Error(codes.Canceled, "context canceled"), ErrCanceled},
+		{"deadline", context.DeadlineExceeded, ErrUnavailable},
+		{"precondition reason", reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_WRITE_OR_DELETE_PRECONDITION_FAILURE, "no match"), ErrConflict},
+		{"unknown definition", reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION, "object definition `x` not found"), ErrSchemaMismatch},
+		{"unknown relation", reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_RELATION_OR_PERMISSION, "relation/permission `x` not found"), ErrSchemaMismatch},
+		// Without a reason the code alone says too little to classify.
+		{"bare failed precondition", status.Error(codes.FailedPrecondition, "unable to satisfy write precondition"), nil},
+		{"bare not found", status.Error(codes.NotFound, "No schema has been defined"), nil},
+		{"other reason", reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_MAXIMUM_DEPTH_EXCEEDED, "max depth exceeded"), nil},
+	} {
+		if got := kindOf(tc.err); got != tc.want {
+			t.Errorf("%s: kind = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMemoryErrorKinds(t *testing.T) {
+	a := NewAuthorizer(newEvalClient(t, "folder:f#viewer@user:u"))
+	ctx := context.Background()
+
+	if _, err := a.Check(ctx, "u", "drive", "f", "view"); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("unknown type: err = %v, want ErrSchemaMismatch", err)
+	}
+	if _, err := a.Check(ctx, "u", "folder", "f", "edit"); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("unknown permission: err = %v, want ErrSchemaMismatch", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := a.Check(canceled, "u", "folder", "f", "view"); !errors.Is(err, ErrCanceled) || errors.Is(err, ErrUnavailable) {
+		t.Errorf("canceled: err = %v, want ErrCanceled", err)
+	}
+}
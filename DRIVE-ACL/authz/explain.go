@@ -0,0 +1,289 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Explanation says why a check came out the way it did, in terms of the
+// schema: which relations and arrows led from the resource to the subject,
+// or what excluded it.
+type Explanation struct {
+	Resource       string         `json:"resource"` // "advertiser:123#view"
+	Subject        string         `json:"subject"`  // "users:alice"
+	Permissionship Permissionship `json:"permissionship"`
+	// Path runs from Resource to Subject along the edges that granted the
+	// permission:
+	//
+	//	[advertiser:123#view parent->view partner:Dentsu#user users:alice]
+	//
+	// When the permission was excluded it ends where the exclusion applied.
+	Path []string `json:"path,omitempty"`
+	// ExcludedBy names what took the permission away ("denied_user") and
+	// Exclusion is the path that made it apply.
+	ExcludedBy string   `json:"excluded_by,omitempty"`
+	Exclusion  []string `json:"exclusion,omitempty"`
+	// Missing lists the caveat parameters a conditional result still needs.
+	Missing   []string `json:"missing_context,omitempty"`
+	CheckedAt string   `json:"checked_at,omitempty"`
+}
+
+// String is the explanation on one line:
+//
+//	advertiser:123#view ← parent->view ← partner:Dentsu#user ← users:alice
+//	advertiser:123#view excluded by denied_user (advertiser:123#denied_user ← users:alice)
+func (e *Explanation) String() string {
+	path := strings.Join(e.Path, " ← ")
+	switch {
+	case e.Permissionship == PermissionConditional && len(e.Missing) > 0:
+		return path + " (conditional: needs " + strings.Join(e.Missing, ", ") + ")"
+	case e.Permissionship != PermissionDenied:
+		return path
+	case e.ExcludedBy != "":
+		return path + " excluded by " + e.ExcludedBy + " (" + strings.Join(e.Exclusion, " ← ") + ")"
+	}
+	return e.Resource + ": nothing grants it to " + e.Subject
+}
+
+func Explain(resource ObjectReference, permission string, subject SubjectReference, caveatContext map[string]interface{}) (*Explanation, error) {
+	return ExplainContext(Context(), resource, permission, subject, caveatContext)
+}
+
+func ExplainContext(ctx context.Context, resource ObjectReference, permission string, subject SubjectReference, caveatContext map[string]interface{}) (*Explanation, error) {
+	return Default().Explain(ctx, resource, permission, subject, caveatContext)
+}
+
+// Explain runs the check with SpiceDB's debug tracing and reads the trace
+// against the schema it reports, so support can see why subject holds
+// permission on resource or not. It needs a SpiceDB that returns traces
+// (v1.31 or later) or the MemoryClient.
+func (a *Authorizer) Explain(ctx context.Context, resource ObjectReference, permission string, subject SubjectReference, caveatContext map[string]interface{}) (*Explanation, error) {
+	var caveatStruct *structpb.Struct
+	if len(caveatContext) > 0 {
+		var err error
+		if caveatStruct, err = structpb.NewStruct(caveatContext); err != nil {
+			return nil, &Error{Op: "explain", Kind: ErrInvalidArgument, Err: err}
+		}
+	}
+
+	callCtx, cancel := a.callContext(ctx)
+	defer cancel()
+	resp, err := a.client.CheckPermission(callCtx, &v1.CheckPermissionRequest{
+		Consistency: a.consistency(callCtx),
+		Resource:    resource.proto(),
+		Permission:  permission,
+		Subject:     subject.proto(),
+		Context:     caveatStruct,
+		WithTracing: true,
+	})
+	if err != nil {
+		return nil, wrapErr("explain", err)
+	}
+	root := resp.GetDebugTrace().GetCheck()
+	if root == nil {
+		return nil, &Error{Op: "explain", Err: errors.New("SpiceDB returned no debug trace")}
+	}
+
+	src := resp.GetDebugTrace().GetSchemaUsed()
+	if src == "" {
+		// Without a schema the trace cannot be read: that is this
+		// service's problem, not the caller's.
+		if a.schema == nil {
+			return nil, &Error{Op: "explain", Err: errors.New("SpiceDB sent no schema with the trace and no schema client is configured")}
+		}
+		if src, err = a.ReadSchema(callCtx); err != nil {
+			return nil, err
+		}
+	}
+	s, err := ParseSchema(src)
+	if err != nil {
+		return nil, &Error{Op: "explain", Err: err}
+	}
+
+	ex := &Explanation{
+		Resource:       resource.String() + "#" + permission,
+		Subject:        subject.String(),
+		Permissionship: permissionshipFromProto(resp.Permissionship),
+		CheckedAt:      zedToken(resp.CheckedAt),
+	}
+	x := &explainer{schema: s, subject: ex.Subject}
+	switch ex.Permissionship {
+	case PermissionDenied:
+		ex.Path, ex.ExcludedBy, ex.Exclusion = x.exclusion(root, map[*v1.CheckDebugTrace]bool{})
+	case PermissionConditional:
+		ex.Missing = resp.GetPartialCaveatInfo().GetMissingRequiredContext()
+		fallthrough
+	default:
+		ex.Path = x.grantPath(root)
+	}
+	a.debugf("Explain: %s", ex)
+	return ex, nil
+}
+
+// explainer turns a check trace into paths through the schema.
+type explainer struct {
+	schema  *Schema
+	subject string
+}
+
+func traceObject(t *v1.CheckDebugTrace) string {
+	return t.GetResource().GetObjectType() + ":" + t.GetResource().GetObjectId()
+}
+
+func traceLabel(t *v1.CheckDebugTrace) string {
+	return traceObject(t) + "#" + t.Permission
+}
+
+// grantPath follows t down the subproblems that decided it to the subject.
+func (x *explainer) grantPath(t *v1.CheckDebugTrace) []string {
+	path := []string{traceLabel(t)}
+	if t.GetWasCachedResult() {
+		return append(path, "(cached result)")
+	}
+	var next *v1.CheckDebugTrace
+	for _, sub := range t.GetSubProblems().GetTraces() {
+		if sub.Result == t.Result {
+			next = sub
+			break
+		}
+		if next == nil && sub.Result == v1.CheckDebugTrace_PERMISSIONSHIP_HAS_PERMISSION {
+			next = sub
+		}
+	}
+	if next == nil {
+		// Granted by a relationship straight to the subject.
+		if path[0] != x.subject {
+			path = append(path, x.subject)
+		}
+		return path
+	}
+	return append(path, x.step(t, next, x.grantPath(next))...)
+}
+
+// step is the path from t into its subproblem sub, given sub's own path.
+// Moving to another object is shown as the arrow that did it; the arrow's
+// target is left out when the next step names that object anyway.
+func (x *explainer) step(t, sub *v1.CheckDebugTrace, rest []string) []string {
+	if traceObject(sub) == traceObject(t) || t.PermissionType == v1.CheckDebugTrace_PERMISSION_TYPE_RELATION {
+		return rest
+	}
+	if sub.PermissionType == v1.CheckDebugTrace_PERMISSION_TYPE_PERMISSION && len(rest) > 1 && strings.HasPrefix(rest[1], traceObject(sub)+"#") {
+		rest = rest[1:]
+	}
+	return append([]string{x.arrow(t, sub)}, rest...)
+}
+
+// arrow names the arrow in t's permission that leads to sub, e.g.
+// "parent->view".
+func (x *explainer) arrow(t, sub *v1.CheckDebugTrace) string {
+	def := x.schema.Definitions[t.GetResource().GetObjectType()]
+	var found string
+	if def != nil && def.Permissions[t.Permission] != nil {
+		walkExpr(def.Permissions[t.Permission].Expr, func(e PermExpr) {
+			a, ok := e.(*ArrowExpr)
+			if !ok || a.Target != sub.Permission || found != "" {
+				return
+			}
+			if rel := def.Relations[a.Relation]; rel != nil && allowsType(rel, sub.GetResource().GetObjectType()) {
+				found = a.String()
+			}
+		})
+	}
+	if found == "" {
+		return "->" + sub.Permission
+	}
+	return found
+}
+
+// exclusion finds, below a denied t, the exclusion that took the permission
+// away: the path to the permission it applied to, what excluded it and the
+// path that made the exclusion apply.
+func (x *explainer) exclusion(t *v1.CheckDebugTrace, seen map[*v1.CheckDebugTrace]bool) (path []string, by string, excl []string) {
+	if seen[t] || t.Result != v1.CheckDebugTrace_PERMISSIONSHIP_NO_PERMISSION {
+		return nil, "", nil
+	}
+	seen[t] = true
+	subs := t.GetSubProblems().GetTraces()
+
+	if def := x.schema.Definitions[t.GetResource().GetObjectType()]; def != nil && def.Permissions[t.Permission] != nil {
+		var found string
+		var sub *v1.CheckDebugTrace
+		walkExpr(def.Permissions[t.Permission].Expr, func(e PermExpr) {
+			b, ok := e.(*BinaryExpr)
+			if !ok || b.Op != '-' || sub != nil {
+				return
+			}
+			// Prefer what only the subtracted side names: in
+			// "... - (denied_user & parent->view)", denied_user.
+			for _, s := range subs {
+				if s.Result != v1.CheckDebugTrace_PERMISSIONSHIP_HAS_PERMISSION {
+					continue
+				}
+				name := x.excludedName(t, s, b.Right)
+				if name == "" {
+					continue
+				}
+				if sub == nil || found != "" && x.excludedName(t, sub, b.Left) != "" && x.excludedName(t, s, b.Left) == "" {
+					found, sub = name, s
+				}
+			}
+		})
+		if sub != nil {
+			return []string{traceLabel(t)}, found, x.step(t, sub, x.grantPath(sub))
+		}
+	}
+
+	for _, sub := range subs {
+		p, by, excl := x.exclusion(sub, seen)
+		if by == "" {
+			continue
+		}
+		if traceObject(sub) != traceObject(t) && t.PermissionType == v1.CheckDebugTrace_PERMISSION_TYPE_PERMISSION {
+			p = append([]string{x.arrow(t, sub)}, p...)
+		}
+		return append([]string{traceLabel(t)}, p...), by, excl
+	}
+	return nil, "", nil
+}
+
+// excludedName is the name in expr, one side of an exclusion in t's
+// permission, that sub resolved, or "" if sub is not part of it.
+func (x *explainer) excludedName(t, sub *v1.CheckDebugTrace, expr PermExpr) string {
+	same := traceObject(sub) == traceObject(t)
+	var name string
+	walkExpr(expr, func(e PermExpr) {
+		switch e := e.(type) {
+		case *RefExpr:
+			if same && e.Name == sub.Permission {
+				name = e.Name
+			}
+		case *ArrowExpr:
+			if !same && e.Target == sub.Permission {
+				name = e.String()
+			}
+		}
+	})
+	return name
+}
+
+// walkExpr calls fn on expr and every expression inside it.
+func walkExpr(expr PermExpr, fn func(PermExpr)) {
+	fn(expr)
+	if b, ok := expr.(*BinaryExpr); ok {
+		walkExpr(b.Left, fn)
+		walkExpr(b.Right, fn)
+	}
+}
+
+func allowsType(rel *RelationDef, typ string) bool {
+	for _, st := range rel.Types {
+		if st.Type == typ {
+			return true
+		}
+	}
+	return false
+}
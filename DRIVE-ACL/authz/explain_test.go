@@ -0,0 +1,47 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc"
+)
+
+// schemaless answers checks with a trace but no schema_used, as older SpiceDB
+// releases may, and serves no SchemaService of its own.
+type schemaless struct {
+	v1.PermissionsServiceClient
+}
+
+func (s schemaless) CheckPermission(ctx context.Context, in *v1.CheckPermissionRequest, opts ...grpc.CallOption) (*v1.CheckPermissionResponse, error) {
+	resp, err := s.PermissionsServiceClient.CheckPermission(ctx, in, opts...)
+	if resp.GetDebugTrace() != nil {
+		resp.DebugTrace.SchemaUsed = ""
+	}
+	return resp, err
+}
+
+func TestExplainWithoutSchemaUsed(t *testing.T) {
+	mc := newEvalClient(t, "folder:f#parent@folder:p", "folder:p#viewer@user:u")
+	resource, subject := ObjectReference{Type: "folder", ID: "f"}, SubjectReference{Type: "user", ID: "u"}
+
+	// The schema is read separately when there is a client for it.
+	a := NewAuthorizer(schemaless{mc}, WithSchemaClient(mc))
+	ex, err := a.Explain(context.Background(), resource, "view", subject, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"folder:f#view", "parent->view", "folder:p#viewer", "user:u"}; !reflect.DeepEqual(ex.Path, want) {
+		t.Errorf("path = %v, want %v", ex.Path, want)
+	}
+
+	// Otherwise the service is at fault, not the request.
+	_, err = NewAuthorizer(schemaless{mc}).Explain(context.Background(), resource, "view", subject, nil)
+	var aerr *Error
+	if !errors.As(err, &aerr) || aerr.Kind != nil || errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("err = %v, want an unclassified *Error", err)
+	}
+}
@@ -0,0 +1,266 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// ExportResult is a config rebuilt from stored relationships.
+type ExportResult struct {
+	// Config translates back to every relationship read except the
+	// skipped ones.
+	Config map[string]interface{} `json:"config"`
+	Read   int                    `json:"read"`
+	// Skipped are relationships the config cannot express with the schema
+	// at hand, such as subjects the relation does not admit.
+	Skipped []Relationship `json:"skipped,omitempty"`
+}
+
+func Export() (*ExportResult, error) {
+	return ExportContext(Context())
+}
+
+func ExportContext(ctx context.Context) (*ExportResult, error) {
+	return Default().Export(ctx)
+}
+
+// Export reads every relationship a config can own and turns them back into
+// a config. It follows the deployed schema, or the embedded one when SpiceDB
+// has none or the Authorizer has no schema client.
+func (a *Authorizer) Export(ctx context.Context) (*ExportResult, error) {
+	t := DefaultTranslator()
+	if a.schema != nil {
+		src, err := a.ReadSchema(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if src != "" {
+			deployed, err := ParseSchema(src)
+			if err != nil {
+				return nil, &Error{Op: "export", Kind: ErrSchemaMismatch, Err: err}
+			}
+			t = NewTranslator(deployed)
+		}
+	}
+
+	var stored []Relationship
+	for _, typ := range t.ResourceTypes() {
+		err := a.readRelationships(ctx, &v1.RelationshipFilter{ResourceType: typ}, a.consistency(ctx), func(rel *v1.Relationship) error {
+			stored = append(stored, RelationshipFromProto(rel))
+			return nil
+		})
+		if errors.Is(err, ErrSchemaMismatch) {
+			continue // the embedded schema has a type SpiceDB does not
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.ConfigFromRelationships(stored), nil
+}
+
+// ConfigFromRelationships is Translator.ConfigFromRelationships for the
+// embedded schema.
+func ConfigFromRelationships(rels []Relationship) *ExportResult {
+	return DefaultTranslator().ConfigFromRelationships(rels)
+}
+
+// ConfigFromRelationships is the inverse of Translate. Objects whose parent
+// is an object of the same type are nested under its "children"; one with
+// several such parents is nested under the first and lists the rest in
+// "parent". Lists are sorted so exports diff cleanly.
+func (t *Translator) ConfigFromRelationships(rels []Relationship) *ExportResult {
+	res := &ExportResult{Read: len(rels)}
+	var candidates []Relationship
+	for _, r := range rels {
+		if _, ok := t.configValue(r); ok {
+			candidates = append(candidates, r)
+		} else {
+			res.Skipped = append(res.Skipped, r)
+		}
+	}
+	sortRelationships(candidates)
+
+	// Drop whatever would not translate back the same way and rebuild.
+	for {
+		res.Config = t.buildConfig(candidates)
+		back := map[string]bool{}
+		translated, _ := t.translate(res.Config)
+		for _, tr := range translated {
+			back[tr.Relationship.String()] = true
+		}
+		kept := candidates[:0:0]
+		for _, r := range candidates {
+			if back[r.String()] {
+				kept = append(kept, r)
+			} else {
+				res.Skipped = append(res.Skipped, r)
+			}
+		}
+		if len(kept) == len(candidates) {
+			break
+		}
+		candidates = kept
+	}
+	sortRelationships(res.Skipped)
+	return res
+}
+
+// configValue is the value r contributes under its relation's key: true for
+// a flag, a string for a subject, or a grant object.
+func (t *Translator) configValue(r Relationship) (interface{}, bool) {
+	if t.sections[r.ResourceType] == "" {
+		return nil, false
+	}
+	rd := t.schema.Relation(r.ResourceType, r.Relation)
+	if rd == nil {
+		return nil, false
+	}
+	plain := r.Caveat == "" && r.Expiration.IsZero()
+	if plain && r.SubjectID == "*" && onlyWildcards(rd) {
+		return true, true
+	}
+	subject := r.Subject()
+	if r.SubjectRelation == "" {
+		if types := plainTypes(rd, r.SubjectID == "*"); len(types) == 1 && types[0] == r.SubjectType {
+			subject = r.SubjectID
+		}
+	}
+	if plain {
+		return subject, true
+	}
+	key := "subject"
+	if r.SubjectType == "users" {
+		key = "user"
+	}
+	g := map[string]interface{}{key: subject}
+	if r.Caveat != "" {
+		g["caveat"] = r.Caveat
+	}
+	if len(r.CaveatContext) > 0 {
+		g["context"] = r.CaveatContext
+	}
+	if !r.Expiration.IsZero() {
+		g["expiration"] = r.Expiration.UTC().Format(time.RFC3339)
+	}
+	return g, true
+}
+
+// nestsUnder reports whether r makes its resource a child of another object
+// of the same type.
+func (t *Translator) nestsUnder(r Relationship) bool {
+	return r.Relation == "parent" && r.SubjectType == r.ResourceType && r.SubjectRelation == "" &&
+		r.SubjectID != "*" && r.Caveat == "" && r.Expiration.IsZero() && t.nests(r.ResourceType)
+}
+
+// buildConfig assembles the config from relationships configValue accepts,
+// sorted by key.
+func (t *Translator) buildConfig(rels []Relationship) map[string]interface{} {
+	config := map[string]interface{}{}
+	objects := map[string]map[string]interface{}{} // "type:id" → its config object
+	var order []string
+	object := func(k string) map[string]interface{} {
+		if o := objects[k]; o != nil {
+			return o
+		}
+		o := map[string]interface{}{}
+		objects[k] = o
+		order = append(order, k)
+		return o
+	}
+
+	parents := map[string][]string{} // "type:id" → "type:parent" of the same type
+	for _, r := range rels {
+		k := r.ResourceType + ":" + r.ResourceID
+		o := object(k)
+		if t.nestsUnder(r) {
+			parents[k] = append(parents[k], r.Subject())
+			continue
+		}
+		value, _ := t.configValue(r)
+		key := keyName(t.schema.Relation(r.ResourceType, r.Relation))
+		if value == true {
+			o[key] = true
+			continue
+		}
+		list, _ := o[key].([]interface{})
+		o[key] = append(list, value)
+	}
+
+	// Nest each object under its first parent, then undo enough of that to
+	// break cycles: a cycle has no top-level member to hang from.
+	nest := map[string]string{}
+	for _, k := range order {
+		if ps := parents[k]; len(ps) > 0 {
+			nest[k] = ps[0]
+		}
+	}
+	for _, k := range order {
+		seen := map[string]bool{k: true}
+		for p, ok := nest[k]; ok; p, ok = nest[p] {
+			if p == k {
+				delete(nest, k)
+				break
+			}
+			if seen[p] {
+				break
+			}
+			seen[p] = true
+		}
+	}
+
+	for _, k := range order {
+		o := objects[k]
+		for _, p := range parents[k] {
+			if p != nest[k] {
+				list, _ := o["parent"].([]interface{})
+				o["parent"] = append(list, p)
+			}
+		}
+		if list, ok := o["parent"].([]interface{}); ok {
+			sort.SliceStable(list, func(i, j int) bool { return subjectKey(list[i]) < subjectKey(list[j]) })
+		}
+		if p, nested := nest[k]; nested {
+			parent := object(p)
+			children, _ := parent["children"].(map[string]interface{})
+			if children == nil {
+				children = map[string]interface{}{}
+				parent["children"] = children
+			}
+			_, id, _ := strings.Cut(k, ":")
+			children[id] = o
+		}
+	}
+	// order may have grown by parents that have no relationships of their own.
+	for _, k := range order {
+		if _, nested := nest[k]; nested {
+			continue
+		}
+		typ, id, _ := strings.Cut(k, ":")
+		section, _ := config[sectionName(typ)].(map[string]interface{})
+		if section == nil {
+			section = map[string]interface{}{}
+			config[sectionName(typ)] = section
+		}
+		section[id] = objects[k]
+	}
+	return config
+}
+
+// subjectKey sorts subjects and grant objects by subject.
+func subjectKey(v interface{}) string {
+	if g, ok := v.(map[string]interface{}); ok {
+		if s, ok := g["user"].(string); ok {
+			return s
+		}
+		s, _ := g["subject"].(string)
+		return s
+	}
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,52 @@
+package authz
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// ObjectRelationships is every translated relationship on one object.
+type ObjectRelationships struct {
+	Object        string                   `json:"object"` // "partner:Dentsu"
+	Relationships []TranslatedRelationship `json:"relationships"`
+}
+
+// GroupByObject groups rels by resource object, keeping the order in which
+// objects first appear, so grouped Translate output stays in config order.
+func GroupByObject(rels []TranslatedRelationship) []ObjectRelationships {
+	var groups []ObjectRelationships
+	index := map[string]int{}
+	for _, tr := range rels {
+		obj := tr.Relationship.ResourceType + ":" + tr.Relationship.ResourceID
+		i, ok := index[obj]
+		if !ok {
+			i = len(groups)
+			index[obj] = i
+			groups = append(groups, ObjectRelationships{Object: obj})
+		}
+		groups[i].Relationships = append(groups[i].Relationships, tr)
+	}
+	return groups
+}
+
+// FormatGrouped writes groups for people to read, one object per block:
+//
+//	partner:Dentsu
+//	  #root@superroot:root    partners.Dentsu.root
+//	  #user@users:alice       partners.Dentsu.users
+func FormatGrouped(w io.Writer, groups []ObjectRelationships) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, g.Object)
+		for _, tr := range g.Relationships {
+			// Drop the "type:id" prefix every line in the block shares.
+			fmt.Fprintf(tw, "  %s\t%s\n", strings.TrimPrefix(tr.Relationship.String(), g.Object), tr.Path)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,317 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// DefaultMaxDepth is the longest parent chain allowed unless WithMaxDepth
+// says otherwise: partner → advertiser → 30 levels of features.
+const DefaultMaxDepth = 32
+
+// HierarchyError reports parent chains that loop or run too deep. Writes
+// return it wrapped in an ErrInvalidArgument *Error.
+type HierarchyError struct {
+	// Cycles are loops of "type:id" objects, each starting and ending with
+	// the same object: [feature:a feature:b feature:a].
+	Cycles [][]string `json:"cycles,omitempty"`
+	// TooDeep are the objects more than MaxDepth parents below the top.
+	TooDeep  []string `json:"too_deep,omitempty"`
+	MaxDepth int      `json:"max_depth,omitempty"`
+}
+
+func (e *HierarchyError) Error() string {
+	var parts []string
+	for _, c := range e.Cycles {
+		parts = append(parts, "parent cycle "+strings.Join(c, " → "))
+	}
+	if len(e.TooDeep) > 0 {
+		parts = append(parts, fmt.Sprintf("%d object(s) more than %d parents deep (first: %s)", len(e.TooDeep), e.MaxDepth, e.TooDeep[0]))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// CheckHierarchy returns a *HierarchyError if the parent relationships in
+// rels form a cycle or a chain longer than maxDepth. maxDepth <= 0 only
+// checks for cycles.
+func CheckHierarchy(rels []Relationship, maxDepth int) error {
+	if herr := findHierarchyIssues(rels, maxDepth); herr != nil {
+		return herr
+	}
+	return nil
+}
+
+// isParentEdge reports whether r links its resource to a parent object.
+func isParentEdge(r Relationship) bool {
+	return r.Relation == "parent" && r.SubjectRelation == "" && r.SubjectID != "*"
+}
+
+// findHierarchyIssues walks the parent edges in rels depth first, so each
+// object is visited once however many children point at it.
+func findHierarchyIssues(rels []Relationship, maxDepth int) *HierarchyError {
+	parents := map[string][]string{}
+	for _, r := range rels {
+		if isParentEdge(r) {
+			child := r.ResourceType + ":" + r.ResourceID
+			parents[child] = append(parents[child], r.SubjectType+":"+r.SubjectID)
+		}
+	}
+	if len(parents) == 0 {
+		return nil
+	}
+
+	const (
+		onStack = 1
+		done    = 2
+	)
+	state := map[string]int{}
+	depth := map[string]int{}
+	var stack []string
+	herr := &HierarchyError{MaxDepth: maxDepth}
+	seenCycle := map[string]bool{}
+
+	var visit func(n string) int
+	visit = func(n string) int {
+		switch state[n] {
+		case onStack:
+			i := len(stack) - 1
+			for stack[i] != n {
+				i--
+			}
+			cycle := rotateCycle(stack[i:])
+			if k := strings.Join(cycle, " "); !seenCycle[k] {
+				seenCycle[k] = true
+				herr.Cycles = append(herr.Cycles, append(cycle, cycle[0]))
+			}
+			return 0
+		case done:
+			return depth[n]
+		}
+		state[n] = onStack
+		stack = append(stack, n)
+		d := 0
+		for _, p := range parents[n] {
+			if pd := visit(p) + 1; pd > d {
+				d = pd
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = done
+		depth[n] = d
+		return d
+	}
+	for _, n := range sortedKeys(parents) {
+		if visit(n) > maxDepth && maxDepth > 0 {
+			herr.TooDeep = append(herr.TooDeep, n)
+		}
+	}
+
+	if len(herr.Cycles) == 0 && len(herr.TooDeep) == 0 {
+		return nil
+	}
+	return herr
+}
+
+// rotateCycle starts a cycle at its smallest object, so the same loop found
+// from different places compares equal.
+func rotateCycle(cycle []string) []string {
+	min := 0
+	for i, n := range cycle {
+		if n < cycle[min] {
+			min = i
+		}
+	}
+	return append(append([]string{}, cycle[min:]...), cycle[:min]...)
+}
+
+// since drops what was already wrong in before, so a write is only blamed
+// for the problems it introduces.
+func (e *HierarchyError) since(before *HierarchyError) *HierarchyError {
+	if e == nil || before == nil {
+		return e
+	}
+	old := map[string]bool{}
+	for _, c := range before.Cycles {
+		old[strings.Join(c, " ")] = true
+	}
+	for _, n := range before.TooDeep {
+		old[n] = true
+	}
+	out := &HierarchyError{MaxDepth: e.MaxDepth}
+	for _, c := range e.Cycles {
+		if !old[strings.Join(c, " ")] {
+			out.Cycles = append(out.Cycles, c)
+		}
+	}
+	for _, n := range e.TooDeep {
+		if !old[n] {
+			out.TooDeep = append(out.TooDeep, n)
+		}
+	}
+	if len(out.Cycles) == 0 && len(out.TooDeep) == 0 {
+		return nil
+	}
+	return out
+}
+
+// hierarchyWalkLimit is the number of objects a write's parent edges may
+// touch before checkHierarchy stops walking from each of them and scans
+// every parent edge instead, which is fewer reads for a large bulk load.
+const hierarchyWalkLimit = 1000
+
+// checkHierarchy rejects a write of rels that would close a parent cycle or
+// push a chain past the depth limit once combined with what SpiceDB holds.
+// It only reads SpiceDB when rels contain parent relationships, and then
+// only the part of the hierarchy they can affect: the ancestors of the new
+// parents and the descendants of the new children, up to the depth limit.
+func (a *Authorizer) checkHierarchy(ctx context.Context, op string, rels []Relationship) error {
+	var added []Relationship
+	var parents, children []string
+	isParent, isChild := map[string]bool{}, map[string]bool{}
+	for _, r := range rels {
+		if !isParentEdge(r) {
+			continue
+		}
+		added = append(added, r)
+		if p := r.SubjectType + ":" + r.SubjectID; !isParent[p] {
+			isParent[p] = true
+			parents = append(parents, p)
+		}
+		if c := r.ResourceType + ":" + r.ResourceID; !isChild[c] {
+			isChild[c] = true
+			children = append(children, c)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	ctx = WithConsistency(ctx, FullyConsistent())
+	s, err := a.liveSchema(ctx)
+	if err != nil {
+		return err
+	}
+	var stored []Relationship
+	if len(parents)+len(children) > hierarchyWalkLimit {
+		stored, err = a.readParentEdges(ctx, s)
+	} else {
+		stored, err = a.readNearbyParentEdges(ctx, s, parents, children)
+	}
+	if err != nil {
+		return err
+	}
+	before := findHierarchyIssues(stored, a.maxDepth)
+	after := findHierarchyIssues(append(stored, added...), a.maxDepth)
+	if herr := after.since(before); herr != nil {
+		return &Error{Op: op, Kind: ErrInvalidArgument, Err: herr}
+	}
+	return nil
+}
+
+// readNearbyParentEdges reads the stored parent edges above parents and
+// below children a level at a time. Above is enough to find any cycle a new
+// edge closes and how deep the new parents already sit; below is every
+// object whose depth a new edge can change. Both stop at the depth limit,
+// since anything further is too deep either way; only with no limit does
+// the walk up go on until it runs out of parents.
+func (a *Authorizer) readNearbyParentEdges(ctx context.Context, s *Schema, parents, children []string) ([]Relationship, error) {
+	var stored []Relationship
+	edge := func(child, parent string) {
+		ct, cid, _ := strings.Cut(child, ":")
+		pt, pid, _ := strings.Cut(parent, ":")
+		stored = append(stored, rel(ct, cid, "parent", pt, pid))
+	}
+
+	up := map[string]bool{}
+	for _, n := range parents {
+		up[n] = true
+	}
+	for level := 0; len(parents) > 0 && (a.maxDepth <= 0 || level < a.maxDepth); level++ {
+		found, err := a.readParents(ctx, s, parents, "")
+		if err != nil {
+			return nil, err
+		}
+		var next []string
+		for _, child := range parents {
+			for _, p := range found[child] {
+				edge(child, p)
+				if !up[p] {
+					up[p] = true
+					next = append(next, p)
+				}
+			}
+		}
+		parents = next
+	}
+
+	down := map[string]bool{}
+	for _, n := range children {
+		down[n] = true
+	}
+	for level := 0; len(children) > 0 && level < a.maxDepth; level++ {
+		found, err := a.readChildren(ctx, s, children)
+		if err != nil {
+			return nil, err
+		}
+		var next []string
+		for _, parent := range children {
+			for _, c := range found[parent] {
+				edge(c, parent)
+				if !down[c] {
+					down[c] = true
+					next = append(next, c)
+				}
+			}
+		}
+		children = next
+	}
+	return stored, nil
+}
+
+// readParentEdges reads every stored parent edge, one type at a time.
+func (a *Authorizer) readParentEdges(ctx context.Context, s *Schema) ([]Relationship, error) {
+	var stored []Relationship
+	for _, typ := range s.DefinitionOrder {
+		if !s.hasParentRelation(typ, "") {
+			continue
+		}
+		err := a.readRelationships(ctx, &v1.RelationshipFilter{ResourceType: typ, OptionalRelation: "parent"}, a.consistency(ctx), func(rel *v1.Relationship) error {
+			if r := RelationshipFromProto(rel); isParentEdge(r) {
+				stored = append(stored, r)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// hierarchyProblems reports cycles and overly deep chains in a translated
+// config at the path of the object concerned.
+func hierarchyProblems(tr *translation, d *configDecoder, maxDepth int) {
+	rels := make([]Relationship, len(tr.out))
+	for i, r := range tr.out {
+		rels[i] = r.Relationship
+	}
+	herr := findHierarchyIssues(rels, maxDepth)
+	if herr == nil {
+		return
+	}
+	pathOf := func(obj string) string {
+		if p, ok := tr.objects[obj]; ok {
+			return p
+		}
+		return obj
+	}
+	for _, c := range herr.Cycles {
+		d.problemf(pathOf(c[0]), "parent cycle %s", strings.Join(c, " → "))
+	}
+	for _, n := range herr.TooDeep {
+		d.problemf(pathOf(n), "more than %d parents deep", maxDepth)
+	}
+}
@@ -0,0 +1,117 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCheckHierarchy(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDepth int
+		stored   []string
+		write    []string
+		cycles   [][]string
+		tooDeep  []string
+	}{
+		{
+			name:   "closes a stored chain",
+			stored: []string{"folder:a#parent@folder:b", "folder:b#parent@folder:c"},
+			write:  []string{"folder:c#parent@folder:a"},
+			cycles: [][]string{{"folder:a", "folder:b", "folder:c", "folder:a"}},
+		},
+		{
+			name:   "existing cycle elsewhere is not blamed",
+			stored: []string{"folder:x#parent@folder:y", "folder:y#parent@folder:x"},
+			write:  []string{"folder:a#parent@folder:b"},
+		},
+		{
+			name:   "existing cycle above is not blamed",
+			stored: []string{"folder:x#parent@folder:y", "folder:y#parent@folder:x"},
+			write:  []string{"folder:a#parent@folder:x"},
+		},
+		{
+			name:     "pushes stored descendants too deep",
+			maxDepth: 2,
+			stored:   []string{"folder:a#parent@folder:b", "folder:c#parent@folder:d"},
+			write:    []string{"folder:b#parent@folder:c"},
+			tooDeep:  []string{"folder:a"},
+		},
+		{
+			name:     "within the limit",
+			maxDepth: 3,
+			stored:   []string{"folder:a#parent@folder:b", "folder:c#parent@folder:d"},
+			write:    []string{"folder:b#parent@folder:c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.maxDepth == 0 {
+				tt.maxDepth = DefaultMaxDepth
+			}
+			a := NewAuthorizer(newEvalClient(t, tt.stored...), WithMaxDepth(tt.maxDepth))
+			_, err := a.WriteRelationships(context.Background(), parseRels(t, tt.write...))
+			if tt.cycles == nil && tt.tooDeep == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var herr *HierarchyError
+			if !errors.Is(err, ErrInvalidArgument) || !errors.As(err, &herr) {
+				t.Fatalf("err = %v, want a *HierarchyError", err)
+			}
+			if !reflect.DeepEqual(herr.Cycles, tt.cycles) || !reflect.DeepEqual(herr.TooDeep, tt.tooDeep) {
+				t.Errorf("cycles %v, too deep %v; want %v, %v", herr.Cycles, herr.TooDeep, tt.cycles, tt.tooDeep)
+			}
+		})
+	}
+}
+
+func TestCheckHierarchyReadsNearbyEdgesOnly(t *testing.T) {
+	stored := []string{"folder:a#parent@folder:b", "folder:c#parent@folder:a"}
+	for i := 0; i < 50; i++ {
+		stored = append(stored, fmt.Sprintf("folder:u%d#parent@folder:u%d", i, i+1))
+	}
+	hook := &readHook{MemoryClient: newEvalClient(t, stored...)}
+	a := NewAuthorizer(hook)
+	if _, err := a.WriteRelationships(context.Background(), parseRels(t, "folder:b#parent@folder:p")); err != nil {
+		t.Fatal(err)
+	}
+	near := map[string]bool{"a": true, "b": true, "c": true, "p": true}
+	for _, f := range hook.filters {
+		id := f.OptionalResourceId
+		if id == "" {
+			id = f.GetOptionalSubjectFilter().GetOptionalSubjectId()
+		}
+		if !near[id] {
+			t.Errorf("read %v, outside the written edge's ancestors and descendants", f)
+		}
+	}
+	// Up from p: one read. Down from b: a, then c, then nothing.
+	if len(hook.filters) != 4 {
+		t.Errorf("%d reads, want 4", len(hook.filters))
+	}
+}
+
+func TestCheckHierarchyLargeWriteScans(t *testing.T) {
+	// More objects than hierarchyWalkLimit: the check reads every parent
+	// edge once instead of walking from each object.
+	var write []string
+	for i := 0; i < hierarchyWalkLimit; i++ {
+		write = append(write, fmt.Sprintf("folder:n%d#parent@folder:n%d", i, i+1))
+	}
+	hook := &readHook{MemoryClient: newEvalClient(t, fmt.Sprintf("folder:n%d#parent@folder:n0", hierarchyWalkLimit))}
+	a := NewAuthorizer(hook, WithMaxDepth(0))
+	_, err := a.WriteRelationships(context.Background(), parseRels(t, write...))
+	var herr *HierarchyError
+	if !errors.As(err, &herr) || len(herr.Cycles) != 1 {
+		t.Fatalf("err = %v, want one cycle", err)
+	}
+	if len(hook.filters) != 1 || hook.filters[0].OptionalResourceId != "" {
+		t.Errorf("reads = %v, want one scan of folder parents", hook.filters)
+	}
+}
@@ -0,0 +1,174 @@
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity ranks lint findings.
+type Severity int
+
+const (
+	// SeverityWarning marks policy that is probably, but not surely, a mistake.
+	SeverityWarning Severity = iota
+	// SeverityError marks policy that cannot do what the config says.
+	SeverityError
+)
+
+// ParseSeverity parses "warning" or "error".
+func ParseSeverity(s string) (Severity, error) {
+	switch s {
+	case "warning":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	}
+	return 0, &Error{Op: "parse severity", Kind: ErrInvalidArgument, Err: fmt.Errorf("unknown severity %q (want warning or error)", s)}
+}
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Lint rules.
+const (
+	LintInvalid          = "invalid"            // the config does not translate
+	LintAllowedAndDenied = "allowed-and-denied" // a subject both granted and denied on one object
+	LintUndefinedParent  = "undefined-parent"   // a parent the config does not define
+	LintUnreachable      = "unreachable"        // no parent and no root
+	LintPublicTopLevel   = "public-top-level"   // a wildcard everything below inherits
+	LintRoleWithoutUsers = "role-without-users" // scopes but nobody to scope
+)
+
+// LintFinding is one semantic problem in a config.
+type LintFinding struct {
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Path     string   `json:"path"`
+	Message  string   `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", f.Path, f.Severity, f.Message, f.Rule)
+}
+
+// Lint is Translator.Lint for the embedded schema.
+func Lint(config map[string]interface{}) []LintFinding {
+	return DefaultTranslator().Lint(config)
+}
+
+// Lint reports policy mistakes in a config that translates fine: subjects
+// both granted and denied, parents the config does not define, objects
+// nothing can reach, wildcards on top-level objects and roles without users.
+// Translation problems are reported as LintInvalid errors. Findings are
+// sorted by path.
+func (t *Translator) Lint(doc map[string]interface{}) []LintFinding {
+	tr, problems := t.walk(doc)
+	var findings []LintFinding
+	report := func(sev Severity, rule, path, format string, args ...interface{}) {
+		findings = append(findings, LintFinding{Severity: sev, Rule: rule, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, p := range problems {
+		report(SeverityError, LintInvalid, p.Path, "%s", p.Message)
+	}
+
+	// Relationships per object and relation.
+	byObject := map[string]map[string][]TranslatedRelationship{}
+	for _, r := range tr.out {
+		obj := r.Relationship.ResourceType + ":" + r.Relationship.ResourceID
+		if byObject[obj] == nil {
+			byObject[obj] = map[string][]TranslatedRelationship{}
+		}
+		byObject[obj][r.Relationship.Relation] = append(byObject[obj][r.Relationship.Relation], r)
+	}
+
+	for _, obj := range sortedKeys(tr.objects) {
+		path := tr.objects[obj]
+		rels := byObject[obj]
+		typ, _, _ := strings.Cut(obj, ":")
+		defn := t.schema.Definitions[typ]
+
+		for _, denied := range defn.RelationOrder {
+			granted, ok := strings.CutPrefix(denied, "denied_")
+			if !ok || defn.Relations[granted] == nil {
+				continue
+			}
+			grants := map[string]string{}
+			for _, r := range rels[granted] {
+				grants[r.Relationship.Subject()] = r.Path
+			}
+			for _, r := range rels[denied] {
+				if at, ok := grants[r.Relationship.Subject()]; ok {
+					report(SeverityWarning, LintAllowedAndDenied, r.Path, "%s is also granted %s at %s", r.Relationship.Subject(), granted, at)
+				}
+			}
+		}
+
+		for _, r := range rels["parent"] {
+			p := r.Relationship
+			if p.SubjectID == "*" || p.SubjectRelation != "" {
+				continue
+			}
+			if _, ok := tr.objects[p.SubjectType+":"+p.SubjectID]; !ok {
+				report(SeverityError, LintUndefinedParent, r.Path, "parent %s is not defined in this config", p.Subject())
+			}
+		}
+
+		if defn.Relations["parent"] != nil && len(rels["parent"]) == 0 && len(rels["root"]) == 0 {
+			report(SeverityWarning, LintUnreachable, path, "%s has no parent or root, so nothing it inherits reaches it", obj)
+		}
+
+		if defn.Relations["parent"] == nil && t.isParentType(defn.Name) {
+			for _, rn := range defn.RelationOrder {
+				for _, r := range rels[rn] {
+					if r.Relationship.SubjectID == "*" {
+						report(SeverityWarning, LintPublicTopLevel, r.Path, "%s is open to %s, and everything under %s inherits it", rn, r.Relationship.Subject(), obj)
+					}
+				}
+			}
+		}
+
+		if defn.Relations["scope"] != nil && defn.Relations["user"] != nil && len(rels["scope"]) > 0 && len(rels["user"]) == 0 {
+			report(SeverityWarning, LintRoleWithoutUsers, path, "%s has scopes but no users, so it grants nothing", obj)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Path < findings[j].Path })
+	return findings
+}
+
+// isParentType reports whether some definition's parent relation admits def.
+func (t *Translator) isParentType(def string) bool {
+	for _, name := range t.schema.DefinitionOrder {
+		if name == def {
+			continue
+		}
+		if r := t.schema.Relation(name, "parent"); r != nil {
+			for _, st := range r.Types {
+				if st.Type == def {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// FindingsAtLeast returns the findings of severity min or worse.
+func FindingsAtLeast(findings []LintFinding, min Severity) []LintFinding {
+	var out []LintFinding
+	for _, f := range findings {
+		if f.Severity >= min {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -1,75 +1,118 @@
 package authz
 
 import (
-	"log"
-	"strings"
+	"context"
+	"errors"
+	"fmt"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 )
 
-func LoadRelationships(rels []string) {
-	var updates []*v1.RelationshipUpdate
+// LoadResult reports what LoadRelationships did with its input.
+type LoadResult struct {
+	Written     int          `json:"written"`
+	WrittenAt   string       `json:"zed_token,omitempty"` // ZedToken of the write; pass to AtLeastAsFresh
+	ParseErrors []ParseError `json:"parse_errors,omitempty"`
+}
 
-	for _, r := range rels {
-		// format: "objectType:objectId#relation@subjectType:subjectId"
-		parts := strings.Split(r, "#")
-		if len(parts) != 2 {
-			log.Printf("invalid relation format: %s", r)
-			continue
-		}
-		left, right := parts[0], parts[1]
+// ParseError is a relationship string that could not be parsed.
+type ParseError struct {
+	Line  int    `json:"line"` // zero-based index into the input
+	Pos   int    `json:"pos"`  // byte offset within the line
+	Input string `json:"input"`
+	Msg   string `json:"error"`
+}
 
-		// left = "partner:Dentsu"
-		objParts := strings.Split(left, ":")
-		if len(objParts) != 2 {
-			log.Printf("invalid resource format: %s", left)
-			continue
-		}
-		objType, objId := objParts[0], objParts[1]
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d, position %d: %s: %q", e.Line, e.Pos, e.Msg, e.Input)
+}
 
-		// right = "user@users:alice"
-		relParts := strings.Split(right, "@")
-		if len(relParts) != 2 {
-			log.Printf("invalid relation/subject format: %s", right)
-			continue
-		}
-		relation := relParts[0]
+func LoadRelationships(rels []string) (*LoadResult, error) {
+	return LoadRelationshipsContext(Context(), rels)
+}
+
+func LoadRelationshipsContext(ctx context.Context, rels []string) (*LoadResult, error) {
+	return Default().LoadRelationships(ctx, rels)
+}
 
-		subParts := strings.Split(relParts[1], ":")
-		if len(subParts) != 2 {
-			log.Printf("invalid subject format: %s", relParts[1])
+func WriteRelationships(rels []Relationship) (*LoadResult, error) {
+	return WriteRelationshipsContext(Context(), rels)
+}
+
+func WriteRelationshipsContext(ctx context.Context, rels []Relationship) (*LoadResult, error) {
+	return Default().WriteRelationships(ctx, rels)
+}
+
+// ParseRelationships parses relationship strings (see ParseRelationship),
+// collecting every line that fails rather than stopping at the first.
+func ParseRelationships(lines []string) ([]Relationship, []ParseError) {
+	var rels []Relationship
+	var errs []ParseError
+	for i, line := range lines {
+		r, err := ParseRelationship(line)
+		if err != nil {
+			pe := ParseError{Line: i, Input: line, Msg: err.Error()}
+			var se *RelationshipSyntaxError
+			if errors.As(err, &se) {
+				pe.Pos, pe.Msg = se.Pos, se.Msg
+			}
+			errs = append(errs, pe)
 			continue
 		}
-		subType, subId := subParts[0], subParts[1]
+		rels = append(rels, r)
+	}
+	return rels, errs
+}
 
-		update := &v1.RelationshipUpdate{
-			Operation: v1.RelationshipUpdate_OPERATION_CREATE,
-			Relationship: &v1.Relationship{
-				Resource: &v1.ObjectReference{
-					ObjectType: objType,
-					ObjectId:   objId,
-				},
-				Relation: relation,
-				Subject: &v1.SubjectReference{
-					Object: &v1.ObjectReference{
-						ObjectType: subType,
-						ObjectId:   subId,
-					},
-				},
-			},
+// LoadRelationships parses rels (see ParseRelationship) and writes them to
+// SpiceDB. Nothing is written if any line fails to parse; the result lists
+// every bad line and the error wraps ErrInvalidArgument.
+func (a *Authorizer) LoadRelationships(ctx context.Context, rels []string) (*LoadResult, error) {
+	parsed, errs := ParseRelationships(rels)
+	if len(errs) > 0 {
+		return &LoadResult{ParseErrors: errs}, &Error{
+			Op:   "load relationships",
+			Kind: ErrInvalidArgument,
+			Err:  fmt.Errorf("%d of %d relationships could not be parsed (first: %v)", len(errs), len(rels), errs[0]),
 		}
-		updates = append(updates, update)
 	}
+	return a.WriteRelationships(ctx, parsed)
+}
 
-	if len(updates) == 0 {
-		log.Println("no valid relationships to write")
-		return
+// WriteRelationships creates rels in SpiceDB in one atomic write. A write
+// that would close a parent cycle or exceed the depth limit fails with a
+// *HierarchyError inside an ErrInvalidArgument error.
+func (a *Authorizer) WriteRelationships(ctx context.Context, rels []Relationship) (*LoadResult, error) {
+	result := &LoadResult{}
+	if len(rels) == 0 {
+		a.logf("no valid relationships to write")
+		return result, nil
+	}
+	if err := a.checkHierarchy(ctx, "write relationships", rels); err != nil {
+		return result, err
+	}
+	updates := make([]*v1.RelationshipUpdate, len(rels))
+	for i, r := range rels {
+		rel, err := r.Proto()
+		if err != nil {
+			return result, err
+		}
+		updates[i] = &v1.RelationshipUpdate{
+			Operation:    v1.RelationshipUpdate_OPERATION_CREATE,
+			Relationship: rel,
+		}
 	}
 
-	_, err := Client.WriteRelationships(Context(), &v1.WriteRelationshipsRequest{
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+
+	resp, err := a.client.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{
 		Updates: updates,
 	})
 	if err != nil {
-		log.Fatalf("failed to write relationships: %v", err)
+		return result, wrapErr("write relationships", err)
 	}
+	result.Written = len(updates)
+	result.WrittenAt = zedToken(resp.WrittenAt)
+	return result, nil
 }
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"sort"
 	"strings"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
@@ -12,16 +12,39 @@ import (
 
 // Node represents a generic resource with children
 type Node struct {
-	ID       string  `json:"id"`
-	Type     string  `json:"type"`
-	Children []*Node `json:"children,omitempty"`
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Paths, set by ListResourceSubtree, are the chains of objects from the
+	// root down to this node's parent that make it visible, at most
+	// maxNodePaths of them. A node with several parents is shared: the same
+	// *Node appears under each.
+	Paths [][]string `json:"paths,omitempty"`
+	// Permissions holds the subject's result for each permission the lookup
+	// was asked to annotate with, e.g. {"view": "granted", "admin": "denied"}.
+	Permissions map[string]Permissionship `json:"permissions,omitempty"`
+	Children    []*Node                   `json:"children,omitempty"`
 }
 
-func ListResourceHierarchy(resourceType, permission, subjectType, subjectID string) *Node {
-	ctx := context.Background()
-	fmt.Println("[DEBUG] Listing hierarchy for resourceType:", resourceType)
-	// Step 1: Lookup resources
-	resp, err := Client.LookupResources(ctx, &v1.LookupResourcesRequest{
+// maxNodePaths caps Node.Paths; a deep diamond-shaped DAG has exponentially
+// many.
+const maxNodePaths = 32
+
+func LookupResources(resourceType, permission, subjectType, subjectID string) ([]string, error) {
+	return LookupResourcesContext(Context(), resourceType, permission, subjectType, subjectID)
+}
+
+func LookupResourcesContext(ctx context.Context, resourceType, permission, subjectType, subjectID string) ([]string, error) {
+	return Default().LookupResources(ctx, resourceType, permission, subjectType, subjectID)
+}
+
+// LookupResources returns the IDs of every resourceType the subject holds
+// permission on.
+func (a *Authorizer) LookupResources(ctx context.Context, resourceType, permission, subjectType, subjectID string) ([]string, error) {
+	ctx, alive, cancel := a.streamContext(ctx)
+	defer cancel()
+
+	resp, err := a.client.LookupResources(ctx, &v1.LookupResourcesRequest{
+		Consistency:        a.consistency(ctx),
 		ResourceObjectType: resourceType,
 		Permission:         permission,
 		Subject: &v1.SubjectReference{
@@ -32,33 +55,65 @@ func ListResourceHierarchy(resourceType, permission, subjectType, subjectID stri
 		},
 	})
 	if err != nil {
-		log.Printf("failed to lookup resources: %v", err)
-		return nil
+		return nil, wrapErr("lookup resources", streamErr(ctx, err))
 	}
 
-	resourceIDs := map[string]bool{}
+	var ids []string
 	for {
 		r, err := resp.Recv()
-		fmt.Println("[DEBUG] Waiting for resource...", r)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			break
+			return nil, wrapErr("lookup resources", streamErr(ctx, err))
 		}
-		fmt.Println("[DEBUG] Found resource:", r.ResourceObjectId)
-		resourceIDs[r.ResourceObjectId] = true
+		alive()
+		a.debugf("Found resource: %s", r.ResourceObjectId)
+		ids = append(ids, r.ResourceObjectId)
 	}
+	return ids, nil
+}
 
-	// Step 2: Read relationships
-	parentResp, err := Client.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
-		RelationshipFilter: &v1.RelationshipFilter{
-			OptionalRelation: "parent",
-		},
-	})
+func ListResourceHierarchy(resourceType, permission, subjectType, subjectID string, annotate ...string) (*Node, error) {
+	return ListResourceHierarchyContext(Context(), resourceType, permission, subjectType, subjectID, annotate...)
+}
+
+func ListResourceHierarchyContext(ctx context.Context, resourceType, permission, subjectType, subjectID string, annotate ...string) (*Node, error) {
+	return Default().ListResourceHierarchy(ctx, resourceType, permission, subjectType, subjectID, annotate...)
+}
+
+// ListResourceHierarchy returns the resourceType objects visible to the subject,
+// nested by same-type parent relationships. Each node carries the subject's
+// result for every permission in annotate (see Node.Permissions).
+func (a *Authorizer) ListResourceHierarchy(ctx context.Context, resourceType, permission, subjectType, subjectID string, annotate ...string) (*Node, error) {
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+
+	a.debugf("Listing hierarchy for resourceType: %s", resourceType)
+	// Step 1: Lookup resources
+	ids, err := a.LookupResources(ctx, resourceType, permission, subjectType, subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceIDs := map[string]bool{}
+	for _, id := range ids {
+		resourceIDs[id] = true
+	}
+
+	// Step 2: Read the parents of the visible objects only, not every parent
+	// edge in the datastore.
+	objects := make([]string, len(ids))
+	for i, id := range ids {
+		objects[i] = resourceType + ":" + id
+	}
+	s, err := a.liveSchema(ctx)
 	if err != nil {
-		log.Printf("failed to read relationships: %v", err)
-		return nil
+		return nil, err
+	}
+	parents, err := a.readParents(ctx, s, objects, resourceType)
+	if err != nil {
+		return nil, err
 	}
 
 	type edge struct {
@@ -67,25 +122,21 @@ func ListResourceHierarchy(resourceType, permission, subjectType, subjectID stri
 	}
 
 	edges := []edge{}
-	for {
-		rel, err := parentResp.Recv()
-		if err == io.EOF {
-			break
+	for _, child := range objects {
+		for _, parent := range parents[child] {
+			_, parentID, _ := strings.Cut(parent, ":")
+			edges = append(edges, edge{ChildID: strings.TrimPrefix(child, resourceType+":"), ParentID: parentID})
 		}
-		if err != nil {
-			break
-		}
-		if rel.Relationship == nil || rel.Relationship.Resource == nil || rel.Relationship.Subject == nil {
-			continue
-		}
-
-		child := rel.Relationship.Resource
-		parent := rel.Relationship.Subject.Object
+	}
 
-		// keep only relationships where BOTH are same resourceType
-		if child.ObjectType == resourceType && parent.ObjectType == resourceType {
-			edges = append(edges, edge{ChildID: child.ObjectId, ParentID: parent.ObjectId})
-		}
+	// A cycle would make the tree infinite, and its members would never show
+	// up as roots.
+	parentRels := make([]Relationship, len(edges))
+	for i, e := range edges {
+		parentRels[i] = rel(resourceType, e.ChildID, "parent", resourceType, e.ParentID)
+	}
+	if herr := findHierarchyIssues(parentRels, 0); herr != nil {
+		return nil, &Error{Op: "list resource hierarchy", Err: herr}
 	}
 
 	// Step 3: Build node map
@@ -100,7 +151,7 @@ func ListResourceHierarchy(resourceType, permission, subjectType, subjectID stri
 		child := nodes[e.ChildID]
 		parent := nodes[e.ParentID]
 		if child != nil && parent != nil {
-			fmt.Println("[DEBUG] Linking", parent.ID, "->", child.ID)
+			a.debugf("Linking %s -> %s", parent.ID, child.ID)
 			parent.Children = append(parent.Children, child)
 			hasParent[e.ChildID] = true
 		}
@@ -108,152 +159,212 @@ func ListResourceHierarchy(resourceType, permission, subjectType, subjectID stri
 
 	// Step 5: Collect roots
 	roots := []*Node{}
-	for id, n := range nodes {
-		if !hasParent[id] {
-			fmt.Println("[DEBUG] Root node:", id)
+	ordered := make([]*Node, 0, len(nodes))
+	for _, id := range sortedKeys(nodes) {
+		ordered = append(ordered, nodes[id])
+		if n := nodes[id]; !hasParent[id] {
+			a.debugf("Root node: %s", id)
 			roots = append(roots, n)
 		}
 	}
 
-	return &Node{ID: "root", Type: resourceType, Children: roots}
+	if err := a.annotate(ctx, subjectType, subjectID, ordered, annotate); err != nil {
+		return nil, err
+	}
+	return &Node{ID: "root", Type: resourceType, Children: roots}, nil
 }
 
 // ListResourceSubtree builds and returns a hierarchical subtree of targetType (feature only)
-func ListResourceSubtree(rootType, rootID, permission, subjectType, subjectID, targetType string) *Node {
-	ctx := context.Background()
+func ListResourceSubtree(rootType, rootID, permission, subjectType, subjectID, targetType string, annotate ...string) (*Node, error) {
+	return ListResourceSubtreeContext(Context(), rootType, rootID, permission, subjectType, subjectID, targetType, annotate...)
+}
+
+func ListResourceSubtreeContext(ctx context.Context, rootType, rootID, permission, subjectType, subjectID, targetType string, annotate ...string) (*Node, error) {
+	return Default().ListResourceSubtree(ctx, rootType, rootID, permission, subjectType, subjectID, targetType, annotate...)
+}
+
+// ListResourceSubtree builds and returns a hierarchical subtree of targetType
+// objects that sit under rootType:rootID. Parents form a DAG: an object with
+// several parents under the root is linked under each target-type parent,
+// and Node.Paths lists every route from the root that makes it visible.
+// Nodes are annotated with the permissions in annotate, as for
+// ListResourceHierarchy.
+func (a *Authorizer) ListResourceSubtree(ctx context.Context, rootType, rootID, permission, subjectType, subjectID, targetType string, annotate ...string) (*Node, error) {
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+
 	rootKey := fmt.Sprintf("%s:%s", rootType, rootID)
 
 	// 1. Accessible resources
 	accessible := map[string]bool{}
 	if subjectType != "" && subjectID != "" && targetType != "" {
-		fmt.Println("[DEBUG] Running LookupResources for", targetType)
-		resp, err := Client.LookupResources(ctx, &v1.LookupResourcesRequest{
-			ResourceObjectType: targetType,
-			Permission:         permission,
-			Subject: &v1.SubjectReference{
-				Object: &v1.ObjectReference{
-					ObjectType: subjectType,
-					ObjectId:   subjectID,
-				},
-			},
-		})
+		a.debugf("Running LookupResources for %s", targetType)
+		ids, err := a.LookupResources(ctx, targetType, permission, subjectType, subjectID)
 		if err != nil {
-			log.Printf("lookup failed: %v", err)
-		} else {
-			for {
-				r, err := resp.Recv()
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					log.Printf("lookup recv error: %v", err)
-					break
-				}
-				key := fmt.Sprintf("%s:%s", targetType, r.ResourceObjectId)
-				accessible[key] = true
-				fmt.Println("[DEBUG] Accessible resource:", key)
-			}
+			return nil, err
+		}
+		for _, id := range ids {
+			key := fmt.Sprintf("%s:%s", targetType, id)
+			accessible[key] = true
+			a.debugf("Accessible resource: %s", key)
 		}
 	}
 
-	// 2. Parent relationships
-	parentMap := make(map[string]string)
-	parentResp, err := Client.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
-		RelationshipFilter: &v1.RelationshipFilter{OptionalRelation: "parent"},
-	})
+	// 2. Parent relationships, fetched a level at a time from the accessible
+	// nodes up, so only chains that can lead to the root are read. Every
+	// parent is kept: a feature may hang under several objects at once.
+	s, err := a.liveSchema(ctx)
 	if err != nil {
-		log.Printf("read rel error: %v", err)
-		return nil
+		return nil, err
 	}
-	for {
-		rel, err := parentResp.Recv()
-		if err == io.EOF {
-			break
-		}
+	parentMap := make(map[string][]string)
+	frontier := sortedKeys(accessible)
+	queued := map[string]bool{rootKey: true}
+	for _, n := range frontier {
+		queued[n] = true
+	}
+	for level := 0; len(frontier) > 0 && (a.maxDepth <= 0 || level <= a.maxDepth); level++ {
+		parents, err := a.readParents(ctx, s, frontier, "")
 		if err != nil {
-			log.Printf("recv rel error: %v", err)
-			break
+			return nil, err
 		}
-		if rel.Relationship == nil || rel.Relationship.Resource == nil || rel.Relationship.Subject == nil {
-			continue
+		var next []string
+		for _, child := range frontier {
+			ps := parents[child]
+			sort.Strings(ps)
+			parentMap[child] = ps
+			for _, p := range ps {
+				a.debugf("ParentRel: %s -> %s", child, p)
+				if !queued[p] {
+					queued[p] = true
+					next = append(next, p)
+				}
+			}
 		}
-		childKey := fmt.Sprintf("%s:%s", rel.Relationship.Resource.ObjectType, rel.Relationship.Resource.ObjectId)
-		parentKey := fmt.Sprintf("%s:%s", rel.Relationship.Subject.Object.ObjectType, rel.Relationship.Subject.Object.ObjectId)
-		parentMap[childKey] = parentKey
-		fmt.Printf("[DEBUG] ParentRel: %s -> %s\n", childKey, parentKey)
+		frontier = next
 	}
-	fmt.Println("[DEBUG] Total parent relationships:", len(parentMap), accessible)
-	// 3. Keep nodes only if path reaches root
-	nodesMap := make(map[string]*Node)
-	keepNodes := map[string]bool{}
+	a.debugf("Total parent relationships: %d %v", len(parentMap), accessible)
 
-	var walkUp func(string) bool
-	walkUp = func(node string) bool {
-		if node == rootKey {
-			keepNodes[node] = true
-			return true
+	// 3. Keep nodes with at least one parent path to the root. visit
+	// remembers each answer, so a node shared by several children is walked
+	// once, and reports a loop or a chain past the depth limit instead of
+	// following it forever.
+	const (
+		onStack = 1
+		done    = 2
+	)
+	reach := map[string]bool{}
+	state := map[string]int{}
+	var stack []string
+	var visit func(n string) (bool, error)
+	visit = func(n string) (bool, error) {
+		if n == rootKey {
+			return true, nil
 		}
-		parent, ok := parentMap[node]
-		if !ok {
-			return false
+		switch state[n] {
+		case done:
+			return reach[n], nil
+		case onStack:
+			i := len(stack) - 1
+			for stack[i] != n {
+				i--
+			}
+			cycle := rotateCycle(stack[i:])
+			return false, &HierarchyError{Cycles: [][]string{append(cycle, cycle[0])}}
 		}
-		if walkUp(parent) {
-			keepNodes[node] = true
-			keepNodes[parent] = true
-			return true
+		if a.maxDepth > 0 && len(stack) > a.maxDepth {
+			return false, &HierarchyError{TooDeep: []string{stack[0]}, MaxDepth: a.maxDepth}
+		}
+		state[n] = onStack
+		stack = append(stack, n)
+		for _, p := range parentMap[n] {
+			ok, err := visit(p)
+			if err != nil {
+				return false, err
+			}
+			reach[n] = reach[n] || ok
 		}
-		return false
+		stack = stack[:len(stack)-1]
+		state[n] = done
+		return reach[n], nil
 	}
-
-	for key := range accessible {
-		fmt.Println("[DEBUG] Checking path for accessible node:", key)
-		if walkUp(key) {
-			fmt.Println("[DEBUG] Path kept:", key, "→ root")
+	for _, key := range sortedKeys(accessible) {
+		kept, err := visit(key)
+		if err != nil {
+			return nil, &Error{Op: "list resource subtree", Err: err}
+		}
+		if kept {
+			a.debugf("Path kept: %s → root", key)
 		} else {
-			fmt.Println("[DEBUG] Path discarded (not under root):", key)
+			a.debugf("Path discarded (not under root): %s", key)
 		}
 	}
 
-	// 4. Build feature-only nodes
-	for key := range keepNodes {
-		parts := strings.SplitN(key, ":", 2)
-		if len(parts) != 2 {
-			continue
+	// 4. The root paths through which each kept node is visible.
+	paths := map[string][][]string{}
+	var pathsTo func(n string) [][]string
+	pathsTo = func(n string) [][]string {
+		if ps, ok := paths[n]; ok {
+			return ps
 		}
-		if parts[0] != targetType {
-			fmt.Println("[DEBUG] Skipping non-target type node:", key)
-			continue // skip non-feature types
+		var out [][]string
+		for _, p := range parentMap[n] {
+			switch {
+			case p == rootKey:
+				out = append(out, []string{rootKey})
+			case reach[p]:
+				for _, via := range pathsTo(p) {
+					out = append(out, append(append([]string{}, via...), p))
+				}
+			}
 		}
-		if _, ok := nodesMap[key]; !ok {
-			nodesMap[key] = &Node{Type: parts[0], ID: parts[1]}
-			fmt.Println("[DEBUG] Node created:", key)
+		if len(out) > maxNodePaths {
+			out = out[:maxNodePaths]
 		}
+		paths[n] = out
+		return out
 	}
 
-	// 5. Build parent-child links only for feature nodes
-	for child, parent := range parentMap {
-		if _, ok := nodesMap[child]; !ok {
+	// 5. Build target-type nodes
+	nodesMap := make(map[string]*Node)
+	for _, key := range sortedKeys(reach) {
+		typ, id, _ := strings.Cut(key, ":")
+		if !reach[key] || typ != targetType {
 			continue
 		}
-		if _, ok := nodesMap[parent]; !ok {
-			continue
+		nodesMap[key] = &Node{Type: typ, ID: id, Paths: pathsTo(key)}
+		a.debugf("Node created: %s", key)
+	}
+
+	// 6. Link each node under every target-type parent; a shared node is the
+	// same *Node under each of them.
+	hasParent := map[string]bool{}
+	for _, child := range sortedKeys(nodesMap) {
+		for _, parent := range parentMap[child] {
+			if nodesMap[parent] == nil {
+				continue
+			}
+			nodesMap[parent].Children = append(nodesMap[parent].Children, nodesMap[child])
+			hasParent[child] = true
+			a.debugf("Linked %s -> %s", parent, child)
 		}
-		nodesMap[parent].Children = append(nodesMap[parent].Children, nodesMap[child])
-		fmt.Printf("[DEBUG] Linked %s -> %s\n", parent, child)
 	}
 
-	// 6. Collect root-level feature nodes (no feature-type parent)
-	var roots []*Node
-	for key, n := range nodesMap {
-		parentKey, hasParent := parentMap[key]
-		if !hasParent || nodesMap[parentKey] == nil {
-			roots = append(roots, n)
+	// 7. Collect root-level nodes (no target-type parent)
+	var roots, ordered []*Node
+	for _, key := range sortedKeys(nodesMap) {
+		ordered = append(ordered, nodesMap[key])
+		if !hasParent[key] {
+			roots = append(roots, nodesMap[key])
 		}
 	}
+	if err := a.annotate(ctx, subjectType, subjectID, ordered, annotate); err != nil {
+		return nil, err
+	}
 
-	// 7. Return single root node if only one, else dummy root
+	// 8. Return single root node if only one, else dummy root
 	if len(roots) == 1 {
-		return roots[0]
+		return roots[0], nil
 	}
-	return &Node{Type: targetType, ID: "root", Children: roots}
+	return &Node{Type: targetType, ID: "root", Children: roots}, nil
 }
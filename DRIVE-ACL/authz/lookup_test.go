@@ -0,0 +1,137 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
+)
+
+// The benchmarks below keep what users:u can see fixed (one partner with 10
+// advertisers of 5 features each) and grow the rest of the datastore around
+// it. Run with:
+//
+//	go test ./authz -run '^$' -bench . -benchtime 20x
+
+var benchSizes = []int{1000, 10000, 100000}
+
+// benchAuthorizer returns an Authorizer over a MemoryClient holding about
+// size unrelated relationships plus the fixed tree users:u can see.
+func benchAuthorizer(b *testing.B, size int) *Authorizer {
+	b.Helper()
+	s, err := ParseSchema(schema.Zed)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mc := NewMemoryClient(s)
+
+	var rels []string
+	rels = append(rels, "partner:target#user@users:u")
+	for i := 0; i < 10; i++ {
+		adv := fmt.Sprintf("target-%d", i)
+		rels = append(rels, "advertiser:"+adv+"#parent@partner:target")
+		for j := 0; j < 5; j++ {
+			f := fmt.Sprintf("%s-%d", adv, j)
+			rels = append(rels, "feature:"+f+"#parent@advertiser:"+adv, "feature:"+f+"#user@users:u")
+		}
+	}
+	// Unrelated partners, each with advertisers and features of their own.
+	for i := 0; len(rels) < size+101; i++ {
+		adv := fmt.Sprintf("a%d", i)
+		rels = append(rels,
+			fmt.Sprintf("advertiser:%s#parent@partner:p%d", adv, i/20),
+			fmt.Sprintf("feature:%s-f#parent@advertiser:%s", adv, adv),
+			fmt.Sprintf("feature:%s-f#user@users:v%d", adv, i),
+		)
+	}
+
+	// Write straight to the store: the hierarchy check WriteRelationships
+	// runs is not what is being measured.
+	for off := 0; off < len(rels); off += 1000 {
+		end := min(off+1000, len(rels))
+		var updates []*v1.RelationshipUpdate
+		for _, line := range rels[off:end] {
+			r, err := MustParseRelationship(line).Proto()
+			if err != nil {
+				b.Fatal(err)
+			}
+			updates = append(updates, &v1.RelationshipUpdate{Operation: v1.RelationshipUpdate_OPERATION_TOUCH, Relationship: r})
+		}
+		if _, err := mc.WriteRelationships(context.Background(), &v1.WriteRelationshipsRequest{Updates: updates}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return NewAuthorizer(mc, WithDebug(false))
+}
+
+func BenchmarkListResourceSubtree(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("rels=%d", size), func(b *testing.B) {
+			a := benchAuthorizer(b, size)
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n, err := a.ListResourceSubtree(ctx, "partner", "target", "view", "users", "u", "feature")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(n.Children) != 50 {
+					b.Fatalf("got %d features, want 50", len(n.Children))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListResourceHierarchy(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("rels=%d", size), func(b *testing.B) {
+			a := benchAuthorizer(b, size)
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := a.ListResourceHierarchy(ctx, "advertiser", "view", "users", "u"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParentEdges compares reading the parents of the 50 visible
+// features with the scan of every parent edge the lookups used to do.
+func BenchmarkParentEdges(b *testing.B) {
+	for _, size := range benchSizes {
+		a := benchAuthorizer(b, size)
+		ctx := context.Background()
+		s, err := a.liveSchema(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var visible []string
+		for i := 0; i < 10; i++ {
+			for j := 0; j < 5; j++ {
+				visible = append(visible, fmt.Sprintf("feature:target-%d-%d", i, j))
+			}
+		}
+
+		b.Run(fmt.Sprintf("filtered/rels=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := a.readParents(ctx, s, visible, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("full-scan/rels=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := a.readRelationships(ctx, &v1.RelationshipFilter{OptionalRelation: "parent"}, a.consistency(ctx), func(*v1.Relationship) error { return nil })
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package authz
+
+import (
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type permState int
+
+const (
+	noPermission permState = iota
+	conditionalPermission
+	hasPermission
+)
+
+// evalResult is a three-valued permission result. missing lists the caveat
+// parameters that kept a conditional result from being decided.
+type evalResult struct {
+	state   permState
+	missing []string
+}
+
+var (
+	resultNo  = evalResult{state: noPermission}
+	resultYes = evalResult{state: hasPermission}
+)
+
+func (r evalResult) permissionship() v1.CheckPermissionResponse_Permissionship {
+	switch r.state {
+	case hasPermission:
+		return v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION
+	case conditionalPermission:
+		return v1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION
+	}
+	return v1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION
+}
+
+func (r evalResult) lookupPermissionship() v1.LookupPermissionship {
+	if r.state == conditionalPermission {
+		return v1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_CONDITIONAL_PERMISSION
+	}
+	return v1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_HAS_PERMISSION
+}
+
+func (r evalResult) partialInfo() *v1.PartialCaveatInfo {
+	if r.state != conditionalPermission {
+		return nil
+	}
+	return &v1.PartialCaveatInfo{MissingRequiredContext: r.missing}
+}
+
+func union(a, b evalResult) evalResult {
+	switch {
+	case a.state == hasPermission || b.state == hasPermission:
+		return resultYes
+	case a.state == noPermission:
+		return b
+	case b.state == noPermission:
+		return a
+	}
+	return evalResult{state: conditionalPermission, missing: mergeMissing(a.missing, b.missing)}
+}
+
+func intersect(a, b evalResult) evalResult {
+	switch {
+	case a.state == noPermission || b.state == noPermission:
+		return resultNo
+	case a.state == hasPermission:
+		return b
+	case b.state == hasPermission:
+		return a
+	}
+	return evalResult{state: conditionalPermission, missing: mergeMissing(a.missing, b.missing)}
+}
+
+func exclude(a, b evalResult) evalResult {
+	switch {
+	case a.state == noPermission || b.state == hasPermission:
+		return resultNo
+	case a.state == hasPermission && b.state == noPermission:
+		return resultYes
+	}
+	return evalResult{state: conditionalPermission, missing: mergeMissing(a.missing, b.missing)}
+}
+
+// evaluator resolves one check. Results are memoised per object#name so
+// shared subgraphs are walked once. Reaching an entry that is still being
+// computed means the data loops; SpiceDB recurses until its depth limit, so
+// the evaluator fails the same way rather than guess an answer that an
+// exclusion could turn into a grant.
+//
+// With tracing it also records each object#name it resolves as a
+// CheckDebugTrace, the way SpiceDB answers WithTracing. A memoised result
+// reuses the trace recorded when it was first computed.
+type evaluator struct {
+	m         *MemoryClient
+	subject   *v1.SubjectReference
+	caveatCtx map[string]interface{}
+	memo      map[string]*evalResult
+	err       error
+
+	tracing bool
+	traces  map[string]*v1.CheckDebugTrace
+	stack   []*v1.CheckDebugTrace
+	root    *v1.CheckDebugTrace
+}
+
+func (m *MemoryClient) check(resource *v1.ObjectReference, permission string, subject *v1.SubjectReference, caveatCtx map[string]interface{}) (evalResult, error) {
+	res, _, err := m.checkTraced(resource, permission, subject, caveatCtx, false)
+	return res, err
+}
+
+// checkTraced is check that, when tracing, also returns the debug trace.
+func (m *MemoryClient) checkTraced(resource *v1.ObjectReference, permission string, subject *v1.SubjectReference, caveatCtx map[string]interface{}, tracing bool) (evalResult, *v1.CheckDebugTrace, error) {
+	if resource == nil || subject == nil || subject.Object == nil {
+		return resultNo, nil, status.Error(codes.InvalidArgument, "check needs a resource and a subject")
+	}
+	if err := m.schema.checkPermissionName(resource.ObjectType, permission); err != nil {
+		return resultNo, nil, err
+	}
+	if m.schema.Definitions[subject.Object.ObjectType] == nil {
+		return resultNo, nil, reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION, "object definition `%s` not found", subject.Object.ObjectType)
+	}
+	e := &evaluator{m: m, subject: subject, caveatCtx: caveatCtx, memo: map[string]*evalResult{}, tracing: tracing}
+	if tracing {
+		e.traces = map[string]*v1.CheckDebugTrace{}
+	}
+	res := e.eval(resource.ObjectType, resource.ObjectId, permission, 0)
+	return res, e.root, e.err
+}
+
+func (e *evaluator) eval(typ, id, name string, depth int) evalResult {
+	if !e.tracing {
+		return e.resolve(typ, id, name, depth)
+	}
+	key := typ + ":" + id + "#" + name
+	if r, ok := e.memo[key]; ok && r == nil {
+		// Still being computed further up: a cycle, which resolve
+		// reports as an error.
+		t := e.newTrace(typ, id, name)
+		t.Result = v1.CheckDebugTrace_PERMISSIONSHIP_NO_PERMISSION
+		t.Resolution = &v1.CheckDebugTrace_WasCachedResult{WasCachedResult: true}
+		e.addTrace(t)
+		return e.resolve(typ, id, name, depth)
+	}
+	if t := e.traces[key]; t != nil {
+		e.addTrace(t)
+		return e.resolve(typ, id, name, depth)
+	}
+
+	t := e.newTrace(typ, id, name)
+	t.Resolution = &v1.CheckDebugTrace_SubProblems_{SubProblems: &v1.CheckDebugTrace_SubProblems{}}
+	e.addTrace(t)
+	e.traces[key] = t
+	e.stack = append(e.stack, t)
+	res := e.resolve(typ, id, name, depth)
+	e.stack = e.stack[:len(e.stack)-1]
+	switch res.state {
+	case hasPermission:
+		t.Result = v1.CheckDebugTrace_PERMISSIONSHIP_HAS_PERMISSION
+	case conditionalPermission:
+		t.Result = v1.CheckDebugTrace_PERMISSIONSHIP_CONDITIONAL_PERMISSION
+	default:
+		t.Result = v1.CheckDebugTrace_PERMISSIONSHIP_NO_PERMISSION
+	}
+	return res
+}
+
+func (e *evaluator) newTrace(typ, id, name string) *v1.CheckDebugTrace {
+	t := &v1.CheckDebugTrace{
+		Resource:       &v1.ObjectReference{ObjectType: typ, ObjectId: id},
+		Permission:     name,
+		PermissionType: v1.CheckDebugTrace_PERMISSION_TYPE_PERMISSION,
+		Subject:        e.subject,
+	}
+	if def := e.m.schema.Definitions[typ]; def != nil && def.Relations[name] != nil {
+		t.PermissionType = v1.CheckDebugTrace_PERMISSION_TYPE_RELATION
+	}
+	return t
+}
+
+// addTrace records t as a subproblem of the object#name being resolved.
+func (e *evaluator) addTrace(t *v1.CheckDebugTrace) {
+	if len(e.stack) == 0 {
+		e.root = t
+		return
+	}
+	parent := e.stack[len(e.stack)-1].GetSubProblems()
+	parent.Traces = append(parent.Traces, t)
+}
+
+func (e *evaluator) resolve(typ, id, name string, depth int) evalResult {
+	if e.err != nil {
+		return resultNo
+	}
+	if depth > e.m.maxDepth {
+		e.err = reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_MAXIMUM_DEPTH_EXCEEDED, "max depth exceeded: this usually indicates a recursive or too deep data dependency (at %s:%s#%s)", typ, id, name)
+		return resultNo
+	}
+	// A subject set such as roles:admin#user trivially holds itself.
+	s := e.subject
+	if s.OptionalRelation != "" && s.Object.ObjectType == typ && s.Object.ObjectId == id && s.OptionalRelation == name {
+		return resultYes
+	}
+
+	key := typ + ":" + id + "#" + name
+	if r, ok := e.memo[key]; ok {
+		if r == nil {
+			e.err = reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_MAXIMUM_DEPTH_EXCEEDED, "max depth exceeded: this usually indicates a recursive or too deep data dependency (cycle at %s:%s#%s)", typ, id, name)
+			return resultNo
+		}
+		return *r
+	}
+	e.memo[key] = nil
+
+	var res evalResult
+	def := e.m.schema.Definitions[typ]
+	switch {
+	case def == nil:
+		res = resultNo
+	case def.Relations[name] != nil:
+		res = e.evalRelation(typ, id, name, depth)
+	case def.Permissions[name] != nil:
+		res = e.evalExpr(typ, id, def.Permissions[name].Expr, depth)
+	default:
+		res = resultNo
+	}
+	e.memo[key] = &res
+	return res
+}
+
+func (e *evaluator) evalRelation(typ, id, relation string, depth int) evalResult {
+	res := resultNo
+	s := e.subject
+	for _, r := range e.m.tuples(typ, id, relation) {
+		sub := r.Subject
+		var hit evalResult
+		switch {
+		case sub.Object.ObjectType == s.Object.ObjectType && sub.Object.ObjectId == s.Object.ObjectId && sub.OptionalRelation == s.OptionalRelation:
+			hit = resultYes
+		case sub.Object.ObjectId == "*" && sub.Object.ObjectType == s.Object.ObjectType && s.OptionalRelation == "":
+			hit = resultYes
+		case sub.OptionalRelation != "":
+			hit = e.eval(sub.Object.ObjectType, sub.Object.ObjectId, sub.OptionalRelation, depth+1)
+		default:
+			continue
+		}
+		res = union(res, intersect(hit, e.caveat(r)))
+		if res.state == hasPermission {
+			break
+		}
+	}
+	return res
+}
+
+func (e *evaluator) evalExpr(typ, id string, expr PermExpr, depth int) evalResult {
+	switch x := expr.(type) {
+	case *NilExpr:
+		return resultNo
+	case *RefExpr:
+		return e.eval(typ, id, x.Name, depth+1)
+	case *ArrowExpr:
+		res := resultNo
+		for _, r := range e.m.tuples(typ, id, x.Relation) {
+			sub := r.Subject.Object
+			if sub.ObjectId == "*" || e.m.schema.checkPermissionName(sub.ObjectType, x.Target) != nil {
+				continue
+			}
+			res = union(res, intersect(e.eval(sub.ObjectType, sub.ObjectId, x.Target, depth+1), e.caveat(r)))
+			if res.state == hasPermission {
+				break
+			}
+		}
+		return res
+	case *BinaryExpr:
+		l := e.evalExpr(typ, id, x.Left, depth)
+		switch x.Op {
+		case '+':
+			if l.state == hasPermission {
+				return l
+			}
+			return union(l, e.evalExpr(typ, id, x.Right, depth))
+		case '&':
+			if l.state == noPermission {
+				return l
+			}
+			return intersect(l, e.evalExpr(typ, id, x.Right, depth))
+		case '-':
+			if l.state == noPermission {
+				return l
+			}
+			return exclude(l, e.evalExpr(typ, id, x.Right, depth))
+		}
+	}
+	return resultNo
+}
+
+// caveat evaluates the relationship's caveat, if any. Context written on the
+// relationship takes precedence over the context sent with the check.
+func (e *evaluator) caveat(r *v1.Relationship) evalResult {
+	if r.OptionalCaveat == nil || r.OptionalCaveat.CaveatName == "" {
+		return resultYes
+	}
+	def := e.m.schema.Caveats[r.OptionalCaveat.CaveatName]
+	if def == nil {
+		e.err = reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_CAVEAT, "caveat `%s` not found", r.OptionalCaveat.CaveatName)
+		return resultNo
+	}
+	env := map[string]interface{}{}
+	for k, v := range e.caveatCtx {
+		env[k] = v
+	}
+	for k, v := range r.OptionalCaveat.Context.AsMap() {
+		env[k] = v
+	}
+	ok, missing, err := def.evalCaveat(env)
+	switch {
+	case err != nil:
+		e.err = status.Error(codes.InvalidArgument, err.Error())
+		return resultNo
+	case len(missing) > 0:
+		return evalResult{state: conditionalPermission, missing: missing}
+	case ok:
+		return resultYes
+	}
+	return resultNo
+}
+
+// tuples returns the live relationships on typ:id#relation.
+func (m *MemoryClient) tuples(typ, id, relation string) []*v1.Relationship {
+	var out []*v1.Relationship
+	for _, r := range m.byObject[typ+":"+id+"#"+relation] {
+		if !m.expired(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
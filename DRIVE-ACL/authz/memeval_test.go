@@ -0,0 +1,263 @@
+package authz
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const evalTestSchema = `
+definition user {}
+
+caveat in_hours(hour int) {
+  hour >= 9 && hour < 17
+}
+
+definition group {
+  relation member: user | group#member
+}
+
+definition folder {
+  relation parent: folder
+  relation viewer: user | user:* | group#member
+  relation banned: user | group#member
+  relation reader: user with in_hours
+
+  permission view = (viewer + parent->view) - banned
+  permission read = reader
+  permission both = viewer & reader
+}
+`
+
+// newEvalClient returns a MemoryClient over evalTestSchema holding rels,
+// written straight to the store so no hierarchy check gets in the way.
+func newEvalClient(t *testing.T, rels ...string) *MemoryClient {
+	t.Helper()
+	return newSchemaClient(t, evalTestSchema, rels...)
+}
+
+// newSchemaClient is newEvalClient over the schema in src.
+func newSchemaClient(t *testing.T, src string, rels ...string) *MemoryClient {
+	t.Helper()
+	s, err := ParseSchema(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := NewMemoryClient(s)
+	var updates []*v1.RelationshipUpdate
+	for _, line := range rels {
+		r, err := MustParseRelationship(line).Proto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		updates = append(updates, &v1.RelationshipUpdate{Operation: v1.RelationshipUpdate_OPERATION_TOUCH, Relationship: r})
+	}
+	if len(updates) > 0 {
+		if _, err := mc.WriteRelationships(context.Background(), &v1.WriteRelationshipsRequest{Updates: updates}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mc
+}
+
+// evalCheck runs a check written as "folder:f#view@user:u".
+func evalCheck(mc *MemoryClient, check string, caveatContext map[string]interface{}) (*v1.CheckPermissionResponse, error) {
+	r := MustParseRelationship(check)
+	req := &v1.CheckPermissionRequest{
+		Resource:   &v1.ObjectReference{ObjectType: r.ResourceType, ObjectId: r.ResourceID},
+		Permission: r.Relation,
+		Subject: &v1.SubjectReference{
+			Object:           &v1.ObjectReference{ObjectType: r.SubjectType, ObjectId: r.SubjectID},
+			OptionalRelation: r.SubjectRelation,
+		},
+	}
+	if caveatContext != nil {
+		req.Context, _ = structpb.NewStruct(caveatContext)
+	}
+	return mc.CheckPermission(context.Background(), req)
+}
+
+const (
+	has         = v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION
+	no          = v1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION
+	conditional = v1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION
+)
+
+func TestEvaluator(t *testing.T) {
+	tests := []struct {
+		name    string
+		rels    []string
+		check   string
+		context map[string]interface{}
+		want    v1.CheckPermissionResponse_Permissionship
+		missing []string
+	}{
+		{name: "direct", rels: []string{"folder:f#viewer@user:u"}, check: "folder:f#view@user:u", want: has},
+		{name: "no relationship", check: "folder:f#view@user:u", want: no},
+		{name: "wildcard", rels: []string{"folder:f#viewer@user:*"}, check: "folder:f#view@user:u", want: has},
+		{name: "union via arrow", rels: []string{"folder:f#parent@folder:p", "folder:p#viewer@user:u"}, check: "folder:f#view@user:u", want: has},
+		{name: "arrow two levels", rels: []string{"folder:f#parent@folder:p", "folder:p#parent@folder:q", "folder:q#viewer@user:u"}, check: "folder:f#view@user:u", want: has},
+		{name: "subject set", rels: []string{"folder:f#viewer@group:g#member", "group:g#member@user:u"}, check: "folder:f#view@user:u", want: has},
+		{name: "nested subject set", rels: []string{"folder:f#viewer@group:g#member", "group:g#member@group:h#member", "group:h#member@user:u"}, check: "folder:f#view@user:u", want: has},
+		{name: "subject set as subject", rels: []string{"folder:f#viewer@group:g#member"}, check: "folder:f#view@group:g#member", want: has},
+		{name: "exclusion", rels: []string{"folder:f#viewer@user:u", "folder:f#banned@user:u"}, check: "folder:f#view@user:u", want: no},
+		{name: "exclusion via subject set", rels: []string{"folder:f#viewer@user:u", "folder:f#banned@group:g#member", "group:g#member@user:u"}, check: "folder:f#view@user:u", want: no},
+		{name: "exclusion of inherited", rels: []string{"folder:f#parent@folder:p", "folder:p#viewer@user:u", "folder:f#banned@user:u"}, check: "folder:f#view@user:u", want: no},
+		{name: "exclusion of other subject", rels: []string{"folder:f#viewer@user:u", "folder:f#banned@user:v"}, check: "folder:f#view@user:u", want: has},
+		{name: "intersection both", rels: []string{"folder:f#viewer@user:u", "folder:f#reader@user:u[in_hours]"}, check: "folder:f#both@user:u", context: map[string]interface{}{"hour": 10}, want: has},
+		{name: "intersection one side", rels: []string{"folder:f#viewer@user:u"}, check: "folder:f#both@user:u", want: no},
+		{name: "caveat true", rels: []string{"folder:f#reader@user:u[in_hours]"}, check: "folder:f#read@user:u", context: map[string]interface{}{"hour": 10}, want: has},
+		{name: "caveat false", rels: []string{"folder:f#reader@user:u[in_hours]"}, check: "folder:f#read@user:u", context: map[string]interface{}{"hour": 20}, want: no},
+		{name: "caveat missing context", rels: []string{"folder:f#reader@user:u[in_hours]"}, check: "folder:f#read@user:u", want: conditional, missing: []string{"hour"}},
+		{name: "caveat context on relationship", rels: []string{`folder:f#reader@user:u[in_hours:{"hour":12}]`}, check: "folder:f#read@user:u", context: map[string]interface{}{"hour": 20}, want: has},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := newEvalClient(t, tt.rels...)
+			resp, err := evalCheck(mc, tt.check, tt.context)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Permissionship != tt.want {
+				t.Errorf("permissionship = %v, want %v", resp.Permissionship, tt.want)
+			}
+			if got := resp.GetPartialCaveatInfo().GetMissingRequiredContext(); !equalStrings(got, tt.missing) {
+				t.Errorf("missing context = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
+
+func TestEvaluatorCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		rels []string
+	}{
+		{name: "parent cycle", rels: []string{"folder:f#parent@folder:g", "folder:g#parent@folder:f"}},
+		// Answering "no" inside the loop would let the exclusion grant view.
+		{name: "cycle under exclusion", rels: []string{
+			"folder:f#viewer@user:u",
+			"folder:f#banned@group:a#member",
+			"group:a#member@group:b#member",
+			"group:b#member@group:a#member",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := newEvalClient(t, tt.rels...)
+			resp, err := evalCheck(mc, "folder:f#view@user:u", nil)
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("got %v, %v; want a FailedPrecondition error", resp.GetPermissionship(), err)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupResourceIDs runs LookupResources for the subject ("type:id" or
+// "type:id#relation") and returns the IDs found.
+func lookupResourceIDs(t *testing.T, mc *MemoryClient, typ, permission, subject string, caveatContext map[string]interface{}) []string {
+	t.Helper()
+	sub, err := ParseSubjectReference(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &v1.LookupResourcesRequest{ResourceObjectType: typ, Permission: permission, Subject: sub.proto()}
+	if caveatContext != nil {
+		if req.Context, err = structpb.NewStruct(caveatContext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream, err := mc.LookupResources(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, r.ResourceObjectId)
+	}
+	return ids
+}
+
+// lookupSubjectIDs runs LookupSubjects on resource ("type:id") for subjects
+// of typ and returns the IDs found.
+func lookupSubjectIDs(t *testing.T, mc *MemoryClient, resource, permission, typ string, caveatContext map[string]interface{}) []string {
+	t.Helper()
+	rt, rid, _ := strings.Cut(resource, ":")
+	req := &v1.LookupSubjectsRequest{Resource: &v1.ObjectReference{ObjectType: rt, ObjectId: rid}, Permission: permission, SubjectObjectType: typ}
+	var err error
+	if caveatContext != nil {
+		if req.Context, err = structpb.NewStruct(caveatContext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream, err := mc.LookupSubjects(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, r.Subject.SubjectObjectId)
+	}
+	return ids
+}
+
+func TestMemoryLookupsFollowRelationships(t *testing.T) {
+	mc := newEvalClient(t,
+		"folder:a#viewer@user:u",
+		"folder:b#parent@folder:a",
+		"folder:c#viewer@group:g#member",
+		"group:g#member@user:u",
+		"folder:d#viewer@user:*",
+		"folder:e#viewer@user:v",
+	)
+	if got, want := lookupResourceIDs(t, mc, "folder", "view", "user:u", nil), []string{"a", "b", "c", "d"}; !equalStrings(got, want) {
+		t.Errorf("resources = %v, want %v", got, want)
+	}
+	if got, want := lookupSubjectIDs(t, mc, "folder:b", "view", "user", nil), []string{"u"}; !equalStrings(got, want) {
+		t.Errorf("subjects of b = %v, want %v", got, want)
+	}
+	if got, want := lookupSubjectIDs(t, mc, "folder:d", "view", "user", nil), []string{"*"}; !equalStrings(got, want) {
+		t.Errorf("subjects of d = %v, want %v", got, want)
+	}
+
+	// Deleted relationships lead nowhere.
+	_, err := mc.DeleteRelationships(context.Background(), &v1.DeleteRelationshipsRequest{RelationshipFilter: &v1.RelationshipFilter{ResourceType: "group"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lookupResourceIDs(t, mc, "folder", "view", "user:u", nil), []string{"a", "b", "d"}; !equalStrings(got, want) {
+		t.Errorf("resources after delete = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,699 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MemoryClient is an in-process stand-in for SpiceDB. It evaluates a parsed
+// schema over relationships kept in memory and serves the parts of
+// v1.PermissionsServiceClient this package uses, so tests and local
+// development can run without a SpiceDB server.
+//
+// Consistency requirements are accepted and ignored: every read sees the
+// latest write.
+type MemoryClient struct {
+	mu        sync.RWMutex
+	schema    *Schema
+	rels      map[string]*v1.Relationship            // keyed by relKey
+	byObject  map[string]map[string]*v1.Relationship // "type:id#relation" → relKey → rel
+	bySubject map[string]map[string]*v1.Relationship // subject "type:id" → relKey → rel
+	revision  int64
+	maxDepth  int
+	now       func() time.Time
+}
+
+var _ v1.PermissionsServiceClient = (*MemoryClient)(nil)
+
+// NewMemoryClient returns an empty store evaluating schema. A nil schema
+// starts the store with no schema, as a fresh SpiceDB would; write one with
+// WriteSchema.
+func NewMemoryClient(schema *Schema) *MemoryClient {
+	if schema == nil {
+		schema = &Schema{Definitions: map[string]*Definition{}, Caveats: map[string]*CaveatDef{}}
+	}
+	return &MemoryClient{
+		schema:    schema,
+		rels:      map[string]*v1.Relationship{},
+		byObject:  map[string]map[string]*v1.Relationship{},
+		bySubject: map[string]map[string]*v1.Relationship{},
+		maxDepth:  50,
+		now:       time.Now,
+	}
+}
+
+// NewMemoryClientFromSchema parses schema source and returns an empty store.
+func NewMemoryClientFromSchema(src string) (*MemoryClient, error) {
+	s, err := ParseSchema(src)
+	if err != nil {
+		return nil, err
+	}
+	return NewMemoryClient(s), nil
+}
+
+// Schema returns the schema the store evaluates.
+func (m *MemoryClient) Schema() *Schema {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.schema
+}
+
+// Len returns the number of stored relationships.
+func (m *MemoryClient) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.rels)
+}
+
+func (m *MemoryClient) token() *v1.ZedToken {
+	return &v1.ZedToken{Token: "mem-" + strconv.FormatInt(m.revision, 10)}
+}
+
+// relKey identifies a relationship the way SpiceDB does: caveats and
+// expiration are not part of its identity.
+func relKey(r *v1.Relationship) string {
+	s := r.Subject
+	k := r.Resource.ObjectType + ":" + r.Resource.ObjectId + "#" + r.Relation + "@" + s.Object.ObjectType + ":" + s.Object.ObjectId
+	if s.OptionalRelation != "" {
+		k += "#" + s.OptionalRelation
+	}
+	return k
+}
+
+func objectRelKey(r *v1.Relationship) string {
+	return r.Resource.ObjectType + ":" + r.Resource.ObjectId + "#" + r.Relation
+}
+
+func subjectObjectKey(r *v1.Relationship) string {
+	return r.Subject.Object.ObjectType + ":" + r.Subject.Object.ObjectId
+}
+
+func (m *MemoryClient) put(k string, r *v1.Relationship) {
+	m.rels[k] = r
+	ok := objectRelKey(r)
+	if m.byObject[ok] == nil {
+		m.byObject[ok] = map[string]*v1.Relationship{}
+	}
+	m.byObject[ok][k] = r
+	sk := subjectObjectKey(r)
+	if m.bySubject[sk] == nil {
+		m.bySubject[sk] = map[string]*v1.Relationship{}
+	}
+	m.bySubject[sk][k] = r
+}
+
+func (m *MemoryClient) remove(k string) {
+	r, found := m.rels[k]
+	if !found {
+		return
+	}
+	delete(m.rels, k)
+	ok := objectRelKey(r)
+	delete(m.byObject[ok], k)
+	if len(m.byObject[ok]) == 0 {
+		delete(m.byObject, ok)
+	}
+	sk := subjectObjectKey(r)
+	delete(m.bySubject[sk], k)
+	if len(m.bySubject[sk]) == 0 {
+		delete(m.bySubject, sk)
+	}
+}
+
+func (m *MemoryClient) expired(r *v1.Relationship) bool {
+	return r.OptionalExpiresAt != nil && !r.OptionalExpiresAt.AsTime().After(m.now())
+}
+
+// sortedRels returns the live relationships in key order.
+func (m *MemoryClient) sortedRels() []*v1.Relationship {
+	keys := make([]string, 0, len(m.rels))
+	for k, r := range m.rels {
+		if !m.expired(r) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := make([]*v1.Relationship, len(keys))
+	for i, k := range keys {
+		out[i] = m.rels[k]
+	}
+	return out
+}
+
+func matchesFilter(r *v1.Relationship, f *v1.RelationshipFilter) bool {
+	if f == nil {
+		return true
+	}
+	if f.ResourceType != "" && r.Resource.ObjectType != f.ResourceType {
+		return false
+	}
+	if f.OptionalResourceId != "" && r.Resource.ObjectId != f.OptionalResourceId {
+		return false
+	}
+	if f.OptionalResourceIdPrefix != "" && !strings.HasPrefix(r.Resource.ObjectId, f.OptionalResourceIdPrefix) {
+		return false
+	}
+	if f.OptionalRelation != "" && r.Relation != f.OptionalRelation {
+		return false
+	}
+	if sf := f.OptionalSubjectFilter; sf != nil {
+		if sf.SubjectType != "" && r.Subject.Object.ObjectType != sf.SubjectType {
+			return false
+		}
+		if sf.OptionalSubjectId != "" && r.Subject.Object.ObjectId != sf.OptionalSubjectId {
+			return false
+		}
+		if sf.OptionalRelation != nil && r.Subject.OptionalRelation != sf.OptionalRelation.Relation {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates returns, in key order, the live relationships a filter can
+// match. A filter naming resource type, id and relation is served from the
+// per-object index, the way a datastore would, instead of scanning.
+func (m *MemoryClient) candidates(f *v1.RelationshipFilter) []*v1.Relationship {
+	if f == nil || f.ResourceType == "" || f.OptionalResourceId == "" || f.OptionalRelation == "" {
+		return m.sortedRels()
+	}
+	indexed := m.byObject[f.ResourceType+":"+f.OptionalResourceId+"#"+f.OptionalRelation]
+	keys := make([]string, 0, len(indexed))
+	for k, r := range indexed {
+		if !m.expired(r) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := make([]*v1.Relationship, len(keys))
+	for i, k := range keys {
+		out[i] = indexed[k]
+	}
+	return out
+}
+
+// ReadRelationships streams the stored relationships matching the filter in
+// a stable order. Cursors resume after the relationship they name.
+func (m *MemoryClient) ReadRelationships(ctx context.Context, in *v1.ReadRelationshipsRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[v1.ReadRelationshipsResponse], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := m.schema.checkFilter(in.RelationshipFilter); err != nil {
+		return nil, err
+	}
+	after := ""
+	if in.OptionalCursor != nil {
+		after = in.OptionalCursor.Token
+	}
+	var out []*v1.ReadRelationshipsResponse
+	for _, r := range m.candidates(in.RelationshipFilter) {
+		k := relKey(r)
+		if (after != "" && k <= after) || !matchesFilter(r, in.RelationshipFilter) {
+			continue
+		}
+		out = append(out, &v1.ReadRelationshipsResponse{
+			ReadAt:            m.token(),
+			Relationship:      cloneRel(r),
+			AfterResultCursor: &v1.Cursor{Token: k},
+		})
+		if in.OptionalLimit > 0 && len(out) == int(in.OptionalLimit) {
+			break
+		}
+	}
+	return newMemStream(ctx, out), nil
+}
+
+// WriteRelationships validates every update against the schema, checks the
+// preconditions and applies the batch atomically.
+func (m *MemoryClient) WriteRelationships(ctx context.Context, in *v1.WriteRelationshipsRequest, _ ...grpc.CallOption) (*v1.WriteRelationshipsResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPreconditions(in.OptionalPreconditions); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, u := range in.Updates {
+		if u.Relationship == nil || u.Relationship.Resource == nil || u.Relationship.Subject == nil || u.Relationship.Subject.Object == nil {
+			return nil, status.Error(codes.InvalidArgument, "relationship is missing resource or subject")
+		}
+		k := relKey(u.Relationship)
+		if seen[k] {
+			return nil, status.Errorf(codes.InvalidArgument, "found more than one update for relationship `%s` in this request", k)
+		}
+		seen[k] = true
+		if u.Operation == v1.RelationshipUpdate_OPERATION_DELETE {
+			continue
+		}
+		if err := m.schema.ValidateRelationship(u.Relationship); err != nil {
+			return nil, err
+		}
+		if existing, ok := m.rels[k]; u.Operation == v1.RelationshipUpdate_OPERATION_CREATE && ok && !m.expired(existing) {
+			return nil, status.Errorf(codes.AlreadyExists, "could not CREATE relationship `%s`, as it already existed", k)
+		}
+	}
+
+	for _, u := range in.Updates {
+		k := relKey(u.Relationship)
+		switch u.Operation {
+		case v1.RelationshipUpdate_OPERATION_DELETE:
+			m.remove(k)
+		case v1.RelationshipUpdate_OPERATION_CREATE, v1.RelationshipUpdate_OPERATION_TOUCH:
+			m.remove(k)
+			m.put(k, cloneRel(u.Relationship))
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown operation %v", u.Operation)
+		}
+	}
+	m.revision++
+	return &v1.WriteRelationshipsResponse{WrittenAt: m.token()}, nil
+}
+
+func (m *MemoryClient) checkPreconditions(pre []*v1.Precondition) error {
+	for _, p := range pre {
+		found := false
+		for _, r := range m.rels {
+			if !m.expired(r) && matchesFilter(r, p.Filter) {
+				found = true
+				break
+			}
+		}
+		switch {
+		case p.Operation == v1.Precondition_OPERATION_MUST_MATCH && !found:
+			return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_WRITE_OR_DELETE_PRECONDITION_FAILURE, "unable to satisfy write precondition: no relationship matches")
+		case p.Operation == v1.Precondition_OPERATION_MUST_NOT_MATCH && found:
+			return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_WRITE_OR_DELETE_PRECONDITION_FAILURE, "unable to satisfy write precondition: a relationship matches")
+		}
+	}
+	return nil
+}
+
+// DeleteRelationships removes every relationship matching the filter.
+func (m *MemoryClient) DeleteRelationships(ctx context.Context, in *v1.DeleteRelationshipsRequest, _ ...grpc.CallOption) (*v1.DeleteRelationshipsResponse, error) {
+	if in.RelationshipFilter == nil || in.RelationshipFilter.ResourceType == "" {
+		return nil, status.Error(codes.InvalidArgument, "delete requires a resource type")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.schema.checkFilter(in.RelationshipFilter); err != nil {
+		return nil, err
+	}
+	if err := m.checkPreconditions(in.OptionalPreconditions); err != nil {
+		return nil, err
+	}
+	var doomed []string
+	for k, r := range m.rels {
+		if matchesFilter(r, in.RelationshipFilter) {
+			doomed = append(doomed, k)
+		}
+	}
+	progress := v1.DeleteRelationshipsResponse_DELETION_PROGRESS_COMPLETE
+	if in.OptionalLimit > 0 && len(doomed) > int(in.OptionalLimit) {
+		if !in.OptionalAllowPartialDeletions {
+			return nil, reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_TOO_MANY_RELATIONSHIPS_FOR_TRANSACTIONAL_DELETE, "found more than %d relationships to delete", in.OptionalLimit)
+		}
+		sort.Strings(doomed)
+		doomed = doomed[:in.OptionalLimit]
+		progress = v1.DeleteRelationshipsResponse_DELETION_PROGRESS_PARTIAL
+	}
+	for _, k := range doomed {
+		m.remove(k)
+	}
+	m.revision++
+	return &v1.DeleteRelationshipsResponse{
+		DeletedAt:                 m.token(),
+		DeletionProgress:          progress,
+		RelationshipsDeletedCount: uint64(len(doomed)),
+	}, nil
+}
+
+// CheckPermission evaluates permission (or relation) for the subject.
+func (m *MemoryClient) CheckPermission(ctx context.Context, in *v1.CheckPermissionRequest, _ ...grpc.CallOption) (*v1.CheckPermissionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res, trace, err := m.checkTraced(in.Resource, in.Permission, in.Subject, in.Context.AsMap(), in.WithTracing)
+	if err != nil {
+		return nil, err
+	}
+	resp := &v1.CheckPermissionResponse{
+		CheckedAt:         m.token(),
+		Permissionship:    res.permissionship(),
+		PartialCaveatInfo: res.partialInfo(),
+	}
+	if in.WithTracing {
+		resp.DebugTrace = &v1.DebugInformation{Check: trace, SchemaUsed: m.schema.Source}
+	}
+	return resp, nil
+}
+
+// CheckBulkPermissions runs each item as its own check; per-item failures are
+// reported in the pair instead of failing the call.
+func (m *MemoryClient) CheckBulkPermissions(ctx context.Context, in *v1.CheckBulkPermissionsRequest, _ ...grpc.CallOption) (*v1.CheckBulkPermissionsResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	resp := &v1.CheckBulkPermissionsResponse{CheckedAt: m.token()}
+	for _, item := range in.Items {
+		pair := &v1.CheckBulkPermissionsPair{Request: item}
+		res, err := m.check(item.Resource, item.Permission, item.Subject, item.Context.AsMap())
+		if err != nil {
+			pair.Response = &v1.CheckBulkPermissionsPair_Error{Error: status.Convert(err).Proto()}
+		} else {
+			pair.Response = &v1.CheckBulkPermissionsPair_Item{Item: &v1.CheckBulkPermissionsResponseItem{
+				Permissionship:    res.permissionship(),
+				PartialCaveatInfo: res.partialInfo(),
+			}}
+		}
+		resp.Pairs = append(resp.Pairs, pair)
+	}
+	return resp, nil
+}
+
+// ExpandPermissionTree is not supported by the in-memory store.
+func (m *MemoryClient) ExpandPermissionTree(context.Context, *v1.ExpandPermissionTreeRequest, ...grpc.CallOption) (*v1.ExpandPermissionTreeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "ExpandPermissionTree is not supported by MemoryClient")
+}
+
+// LookupResources streams every object of the requested type on which the
+// subject has (or conditionally has) the permission.
+func (m *MemoryClient) LookupResources(ctx context.Context, in *v1.LookupResourcesRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[v1.LookupResourcesResponse], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := m.schema.checkPermissionName(in.ResourceObjectType, in.Permission); err != nil {
+		return nil, err
+	}
+	caveatCtx := in.Context.AsMap()
+	var out []*v1.LookupResourcesResponse
+	for _, id := range m.resourcesReaching(in.ResourceObjectType, in.Subject) {
+		res, err := m.check(&v1.ObjectReference{ObjectType: in.ResourceObjectType, ObjectId: id}, in.Permission, in.Subject, caveatCtx)
+		if err != nil {
+			return nil, err
+		}
+		if res.state == noPermission {
+			continue
+		}
+		out = append(out, &v1.LookupResourcesResponse{
+			LookedUpAt:        m.token(),
+			ResourceObjectId:  id,
+			Permissionship:    res.lookupPermissionship(),
+			PartialCaveatInfo: res.partialInfo(),
+		})
+		if in.OptionalLimit > 0 && len(out) == int(in.OptionalLimit) {
+			break
+		}
+	}
+	return newMemStream(ctx, out), nil
+}
+
+// LookupSubjects streams every subject of the requested type that has (or
+// conditionally has) the permission. A matching wildcard is reported as "*".
+func (m *MemoryClient) LookupSubjects(ctx context.Context, in *v1.LookupSubjectsRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[v1.LookupSubjectsResponse], error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if in.Resource == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing resource")
+	}
+	if err := m.schema.checkPermissionName(in.Resource.ObjectType, in.Permission); err != nil {
+		return nil, err
+	}
+	caveatCtx := in.Context.AsMap()
+	ids, wildcard := m.subjectsReachedFrom(in.Resource, in.SubjectObjectType)
+	if in.OptionalSubjectRelation == "" && wildcard {
+		ids = append([]string{"*"}, ids...)
+	}
+	var out []*v1.LookupSubjectsResponse
+	for _, id := range ids {
+		subject := &v1.SubjectReference{
+			Object:           &v1.ObjectReference{ObjectType: in.SubjectObjectType, ObjectId: id},
+			OptionalRelation: in.OptionalSubjectRelation,
+		}
+		res, err := m.check(in.Resource, in.Permission, subject, caveatCtx)
+		if err != nil {
+			return nil, err
+		}
+		if res.state == noPermission {
+			continue
+		}
+		out = append(out, &v1.LookupSubjectsResponse{
+			LookedUpAt:        m.token(),
+			SubjectObjectId:   id,
+			Permissionship:    res.lookupPermissionship(),
+			PartialCaveatInfo: res.partialInfo(),
+			Subject: &v1.ResolvedSubject{
+				SubjectObjectId:   id,
+				Permissionship:    res.lookupPermissionship(),
+				PartialCaveatInfo: res.partialInfo(),
+			},
+		})
+	}
+	return newMemStream(ctx, out), nil
+}
+
+// ImportBulkRelationships is not supported by the in-memory store.
+func (m *MemoryClient) ImportBulkRelationships(context.Context, ...grpc.CallOption) (grpc.ClientStreamingClient[v1.ImportBulkRelationshipsRequest, v1.ImportBulkRelationshipsResponse], error) {
+	return nil, status.Error(codes.Unimplemented, "ImportBulkRelationships is not supported by MemoryClient")
+}
+
+// ExportBulkRelationships is not supported by the in-memory store.
+func (m *MemoryClient) ExportBulkRelationships(context.Context, *v1.ExportBulkRelationshipsRequest, ...grpc.CallOption) (grpc.ServerStreamingClient[v1.ExportBulkRelationshipsResponse], error) {
+	return nil, status.Error(codes.Unimplemented, "ExportBulkRelationships is not supported by MemoryClient")
+}
+
+// resourcesReaching lists, in order, the IDs of typ that lead to subject
+// through stored relationships, followed backwards from the subject (and
+// its type's wildcard) to every resource naming it, then to every resource
+// naming those. Nothing else can grant subject a permission, so lookups
+// check these instead of every object of typ in the store.
+func (m *MemoryClient) resourcesReaching(typ string, subject *v1.SubjectReference) []string {
+	if subject == nil || subject.Object == nil {
+		return nil
+	}
+	start := []string{subject.Object.ObjectType + ":" + subject.Object.ObjectId}
+	if subject.OptionalRelation == "" {
+		start = append(start, subject.Object.ObjectType+":*")
+	}
+	return m.reach(typ, start, func(obj string) []string {
+		var next []string
+		for _, r := range m.bySubject[obj] {
+			if !m.expired(r) {
+				next = append(next, r.Resource.ObjectType+":"+r.Resource.ObjectId)
+			}
+		}
+		return next
+	})
+}
+
+// subjectsReachedFrom is resourcesReaching the other way round: the IDs of
+// typ found by following stored relationships forwards from resource, and
+// whether typ's wildcard was among them.
+func (m *MemoryClient) subjectsReachedFrom(resource *v1.ObjectReference, typ string) ([]string, bool) {
+	wildcard := false
+	ids := m.reach(typ, []string{resource.ObjectType + ":" + resource.ObjectId}, func(obj string) []string {
+		ot, oid, _ := strings.Cut(obj, ":")
+		def := m.schema.Definitions[ot]
+		if def == nil || oid == "*" {
+			return nil
+		}
+		var next []string
+		for rel := range def.Relations {
+			for _, r := range m.tuples(ot, oid, rel) {
+				if r.Subject.Object.ObjectType == typ && r.Subject.Object.ObjectId == "*" {
+					wildcard = true
+				}
+				next = append(next, subjectObjectKey(r))
+			}
+		}
+		return next
+	})
+	return ids, wildcard
+}
+
+// reach walks from start through next and returns, sorted, the IDs of the
+// typ objects visited, wildcards aside.
+func (m *MemoryClient) reach(typ string, start []string, next func(obj string) []string) []string {
+	seen := map[string]bool{}
+	queue := append([]string(nil), start...)
+	var ids []string
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = queue[1:]
+		if seen[obj] {
+			continue
+		}
+		seen[obj] = true
+		if t, id, _ := strings.Cut(obj, ":"); t == typ && id != "*" {
+			ids = append(ids, id)
+		}
+		queue = append(queue, next(obj)...)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// reasonErr builds a gRPC error carrying the ErrorInfo reason SpiceDB attaches
+// to the same failure, so kindOf classifies it as it would a server error.
+func reasonErr(code codes.Code, reason v1.ErrorReason, format string, args ...any) error {
+	st := status.Newf(code, format, args...)
+	if withInfo, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason.String(), Domain: errorDomain}); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// ValidateRelationship checks a relationship against the schema the way
+// SpiceDB does on write: the resource type and relation must exist, and the
+// subject (with its relation, wildcard and caveat) must be one of the
+// relation's allowed types.
+func (s *Schema) ValidateRelationship(r *v1.Relationship) error {
+	res, sub := r.Resource, r.Subject.Object
+	def := s.Definitions[res.ObjectType]
+	if def == nil {
+		return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION, "object definition `%s` not found", res.ObjectType)
+	}
+	if def.Permissions[r.Relation] != nil {
+		return status.Errorf(codes.InvalidArgument, "cannot write a relationship to permission `%s` under definition `%s`", r.Relation, res.ObjectType)
+	}
+	rel := def.Relations[r.Relation]
+	if rel == nil {
+		return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_RELATION_OR_PERMISSION, "relation/permission `%s` not found under definition `%s`", r.Relation, res.ObjectType)
+	}
+	if s.Definitions[sub.ObjectType] == nil {
+		return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION, "object definition `%s` not found", sub.ObjectType)
+	}
+	caveat := ""
+	if r.OptionalCaveat != nil {
+		caveat = r.OptionalCaveat.CaveatName
+		if s.Caveats[caveat] == nil {
+			return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_CAVEAT, "caveat `%s` not found", caveat)
+		}
+	}
+	wildcard := sub.ObjectId == "*"
+	for _, t := range rel.Types {
+		if t.Type == sub.ObjectType && t.Wildcard == wildcard && t.Relation == r.Subject.OptionalRelation &&
+			t.Caveat == caveat && (t.Expiration || r.OptionalExpiresAt == nil) {
+			return nil
+		}
+	}
+	subject := sub.ObjectType
+	switch {
+	case wildcard:
+		subject += ":*"
+	case r.Subject.OptionalRelation != "":
+		subject += "#" + r.Subject.OptionalRelation
+	}
+	if caveat != "" {
+		subject += " with " + caveat
+	}
+	return status.Errorf(codes.InvalidArgument, "subjects of type `%s` are not allowed on relation `%s#%s`", subject, res.ObjectType, r.Relation)
+}
+
+func (s *Schema) checkPermissionName(typ, name string) error {
+	def := s.Definitions[typ]
+	if def == nil {
+		return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION, "object definition `%s` not found", typ)
+	}
+	if def.Relations[name] == nil && def.Permissions[name] == nil {
+		return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_RELATION_OR_PERMISSION, "relation/permission `%s` not found under definition `%s`", name, typ)
+	}
+	return nil
+}
+
+// checkFilter rejects a filter naming a type or relation the schema lacks,
+// as SpiceDB does instead of matching nothing.
+func (s *Schema) checkFilter(f *v1.RelationshipFilter) error {
+	if f == nil {
+		return nil
+	}
+	if f.ResourceType != "" {
+		if f.OptionalRelation != "" {
+			if err := s.checkPermissionName(f.ResourceType, f.OptionalRelation); err != nil {
+				return err
+			}
+		} else if s.Definitions[f.ResourceType] == nil {
+			return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION, "object definition `%s` not found", f.ResourceType)
+		}
+	}
+	sf := f.OptionalSubjectFilter
+	if sf == nil {
+		return nil
+	}
+	if rel := sf.OptionalRelation.GetRelation(); rel != "" {
+		return s.checkPermissionName(sf.SubjectType, rel)
+	}
+	if s.Definitions[sf.SubjectType] == nil {
+		return reasonErr(codes.FailedPrecondition, v1.ErrorReason_ERROR_REASON_UNKNOWN_DEFINITION, "object definition `%s` not found", sf.SubjectType)
+	}
+	return nil
+}
+
+func cloneRel(r *v1.Relationship) *v1.Relationship {
+	c := &v1.Relationship{
+		Resource: &v1.ObjectReference{ObjectType: r.Resource.ObjectType, ObjectId: r.Resource.ObjectId},
+		Relation: r.Relation,
+		Subject: &v1.SubjectReference{
+			Object:           &v1.ObjectReference{ObjectType: r.Subject.Object.ObjectType, ObjectId: r.Subject.Object.ObjectId},
+			OptionalRelation: r.Subject.OptionalRelation,
+		},
+		OptionalExpiresAt: r.OptionalExpiresAt,
+	}
+	if r.OptionalCaveat != nil {
+		c.OptionalCaveat = &v1.ContextualizedCaveat{CaveatName: r.OptionalCaveat.CaveatName, Context: r.OptionalCaveat.Context}
+	}
+	return c
+}
+
+// memStream serves a precomputed slice as a server stream.
+type memStream[T any] struct {
+	ctx   context.Context
+	items []*T
+}
+
+func newMemStream[T any](ctx context.Context, items []*T) *memStream[T] {
+	return &memStream[T]{ctx: ctx, items: items}
+}
+
+func (s *memStream[T]) Recv() (*T, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+func (s *memStream[T]) Header() (metadata.MD, error) { return metadata.MD{}, nil }
+func (s *memStream[T]) Trailer() metadata.MD         { return metadata.MD{} }
+func (s *memStream[T]) CloseSend() error             { return nil }
+func (s *memStream[T]) Context() context.Context     { return s.ctx }
+func (s *memStream[T]) SendMsg(interface{}) error    { return fmt.Errorf("memStream is receive-only") }
+func (s *memStream[T]) RecvMsg(interface{}) error    { return fmt.Errorf("use Recv") }
@@ -0,0 +1,154 @@
+package authz
+
+import (
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
+)
+
+// The tests below run the MemoryClient over the real schema.zed, whose
+// exclusions only apply where the parent grants view and whose user
+// relations carry caveats.
+
+func TestMemorySchemaZed(t *testing.T) {
+	partnerView := []string{"partner:p#user@users:u", "advertiser:a#parent@partner:p"}
+	window := `partner:p#user@users:u[within_window:{"start_ts":100,"end_ts":200}]`
+	tests := []struct {
+		name    string
+		rels    []string
+		check   string
+		context map[string]interface{}
+		want    v1.CheckPermissionResponse_Permissionship
+		missing []string
+	}{
+		{name: "advertiser inherits partner view", rels: partnerView, check: "advertiser:a#view@users:u", want: has},
+		{
+			name:  "advertiser denied where the partner grants view",
+			rels:  append([]string{"advertiser:a#denied_user@users:u"}, partnerView...),
+			check: "advertiser:a#view@users:u", want: no,
+		},
+		{
+			name:  "advertiser denial needs parent view",
+			rels:  []string{"advertiser:a#public@users:*", "advertiser:a#denied_user@users:u"},
+			check: "advertiser:a#view@users:u", want: has,
+		},
+		{name: "feature parent view alone", rels: append([]string{"feature:f#parent@advertiser:a"}, partnerView...), check: "feature:f#view@users:u", want: no},
+		{
+			name:  "feature user under a visible parent",
+			rels:  append([]string{"feature:f#parent@advertiser:a", "feature:f#user@users:u"}, partnerView...),
+			check: "feature:f#view@users:u", want: has,
+		},
+		{
+			name:  "feature denied under a visible parent",
+			rels:  append([]string{"feature:f#parent@advertiser:a", "feature:f#user@users:u", "feature:f#denied_user@users:u"}, partnerView...),
+			check: "feature:f#view@users:u", want: no,
+		},
+		{
+			name:  "feature denial needs parent view",
+			rels:  []string{"feature:f#public@users:*", "feature:f#denied_user@users:u"},
+			check: "feature:f#view@users:u", want: has,
+		},
+		{
+			// role->scope holds partners, never the user being checked.
+			name:  "partner role with scope",
+			rels:  []string{"partner:p#role@roles:r", "roles:r#user@users:u", "roles:r#scope@partner:p"},
+			check: "partner:p#view@users:u", want: no,
+		},
+		{
+			name:  "advertiser role under a visible parent",
+			rels:  []string{"advertiser:a#parent@partner:p", "partner:p#public@users:*", "advertiser:a#role@roles:r", "roles:r#user@users:u"},
+			check: "advertiser:a#view@users:u", want: has,
+		},
+		{name: "caveated user in window", rels: []string{window}, check: "partner:p#view@users:u", context: map[string]interface{}{"request_time": 150}, want: has},
+		{name: "caveated user out of window", rels: []string{window}, check: "partner:p#view@users:u", context: map[string]interface{}{"request_time": 250}, want: no},
+		{name: "caveated user without context", rels: []string{window}, check: "partner:p#view@users:u", want: conditional, missing: []string{"request_time"}},
+		{
+			name:    "caveated user through a role",
+			rels:    []string{"publisher:b#parent@partner:p", "partner:p#public@users:*", "publisher:b#role@roles:r", `roles:r#user@users:u[is_internal_and_enabled:{"enabled":true,"email_domain":"example.com"}]`},
+			check:   "publisher:b#view@users:u",
+			context: map[string]interface{}{"principal_email": "example.com"},
+			want:    has,
+		},
+		{
+			name:    "caveated user disabled",
+			rels:    []string{`partner:p#user@users:u[is_internal_and_enabled:{"enabled":false,"email_domain":"example.com"}]`},
+			check:   "partner:p#view@users:u",
+			context: map[string]interface{}{"principal_email": "example.com"},
+			want:    no,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := newSchemaClient(t, schema.Zed, tt.rels...)
+			resp, err := evalCheck(mc, tt.check, tt.context)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Permissionship != tt.want {
+				t.Errorf("permissionship = %v, want %v", resp.Permissionship, tt.want)
+			}
+			if got := resp.GetPartialCaveatInfo().GetMissingRequiredContext(); !equalStrings(got, tt.missing) {
+				t.Errorf("missing context = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
+
+func TestMemoryLookupsSchemaZed(t *testing.T) {
+	mc := newSchemaClient(t, schema.Zed,
+		"partner:p#user@users:u",
+		"partner:p#user@users:v",
+		`partner:p#user@users:w[within_window:{"start_ts":100,"end_ts":200}]`,
+		"advertiser:a1#parent@partner:p",
+		"advertiser:a2#parent@partner:p",
+		"advertiser:a2#denied_user@users:u",
+		"advertiser:a3#public@users:*",
+		"advertiser:a3#denied_user@users:u", // no parent, so not excluded
+		"advertiser:a4#public@users:*",
+		"advertiser:other#parent@partner:q",
+		"feature:f1#parent@advertiser:a1",
+		"feature:f1#user@users:u",
+		"feature:f2#parent@advertiser:a1",
+		"feature:f2#user@users:u",
+		"feature:f2#denied_user@users:u",
+	)
+
+	tests := []struct {
+		name, typ, permission, subject string
+		context                        map[string]interface{}
+		want                           []string
+	}{
+		{name: "advertisers", typ: "advertiser", permission: "view", subject: "users:u", want: []string{"a1", "a3", "a4"}},
+		{name: "features", typ: "feature", permission: "view", subject: "users:u", want: []string{"f1"}},
+		{name: "caveated, undecided", typ: "advertiser", permission: "view", subject: "users:w", want: []string{"a1", "a2", "a3", "a4"}},
+		{name: "caveated, out of window", typ: "advertiser", permission: "view", subject: "users:w", context: map[string]interface{}{"request_time": 250}, want: []string{"a3", "a4"}},
+		{name: "stranger", typ: "advertiser", permission: "view", subject: "users:x", want: []string{"a3", "a4"}},
+	}
+	for _, tt := range tests {
+		t.Run("resources/"+tt.name, func(t *testing.T) {
+			if got := lookupResourceIDs(t, mc, tt.typ, tt.permission, tt.subject, tt.context); !equalStrings(got, tt.want) {
+				t.Errorf("LookupResources = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	subjects := []struct {
+		name, resource string
+		context        map[string]interface{}
+		want           []string
+	}{
+		{name: "denied user left out", resource: "advertiser:a2", want: []string{"v", "w"}},
+		{name: "caveated user out of window", resource: "advertiser:a2", context: map[string]interface{}{"request_time": 250}, want: []string{"v"}},
+		{name: "public", resource: "advertiser:a4", want: []string{"*"}},
+		{name: "feature", resource: "feature:f2", want: nil},
+	}
+	for _, tt := range subjects {
+		t.Run("subjects/"+tt.name, func(t *testing.T) {
+			if got := lookupSubjectIDs(t, mc, tt.resource, "view", "users", tt.context); !equalStrings(got, tt.want) {
+				t.Errorf("LookupSubjects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package authz
+
+import (
+	"context"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ v1.SchemaServiceClient = (*MemoryClient)(nil)
+
+// ReadSchema returns the source of the current schema.
+func (m *MemoryClient) ReadSchema(ctx context.Context, _ *v1.ReadSchemaRequest, _ ...grpc.CallOption) (*v1.ReadSchemaResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.schema.Definitions) == 0 && len(m.schema.Caveats) == 0 {
+		return nil, status.Error(codes.NotFound, "No schema has been defined; please call WriteSchema to start")
+	}
+	return &v1.ReadSchemaResponse{SchemaText: m.schema.Source, ReadAt: m.token()}, nil
+}
+
+// WriteSchema replaces the schema. Like SpiceDB it refuses a schema that
+// would leave stored relationships invalid.
+func (m *MemoryClient) WriteSchema(ctx context.Context, in *v1.WriteSchemaRequest, _ ...grpc.CallOption) (*v1.WriteSchemaResponse, error) {
+	s, err := ParseSchema(in.Schema)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.sortedRels() {
+		if err := s.ValidateRelationship(r); err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "cannot apply schema: relationship `%s` exists: %s", relKey(r), status.Convert(err).Message())
+		}
+	}
+	m.schema = s
+	m.revision++
+	return &v1.WriteSchemaResponse{WrittenAt: m.token()}, nil
+}
+
+// ReflectSchema is not supported by the in-memory store.
+func (m *MemoryClient) ReflectSchema(context.Context, *v1.ReflectSchemaRequest, ...grpc.CallOption) (*v1.ReflectSchemaResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "ReflectSchema is not supported in memory")
+}
+
+// ComputablePermissions is not supported by the in-memory store.
+func (m *MemoryClient) ComputablePermissions(context.Context, *v1.ComputablePermissionsRequest, ...grpc.CallOption) (*v1.ComputablePermissionsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "ComputablePermissions is not supported in memory")
+}
+
+// DependentRelations is not supported by the in-memory store.
+func (m *MemoryClient) DependentRelations(context.Context, *v1.DependentRelationsRequest, ...grpc.CallOption) (*v1.DependentRelationsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "DependentRelations is not supported in memory")
+}
+
+// DiffSchema is not supported by the in-memory store; use DiffSchemas.
+func (m *MemoryClient) DiffSchema(context.Context, *v1.DiffSchemaRequest, ...grpc.CallOption) (*v1.DiffSchemaResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "DiffSchema is not supported in memory")
+}
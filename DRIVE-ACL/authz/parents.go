@@ -0,0 +1,156 @@
+package authz
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// DefaultLookupConcurrency bounds the parent reads a hierarchy lookup keeps
+// in flight at once.
+const DefaultLookupConcurrency = 8
+
+// readParents returns the parents of each "type:id" object, read with one
+// filtered ReadRelationships per object and at most a.lookupConcurrency
+// reads at a time. s is the schema the reads are planned against, read
+// once by the caller (see liveSchema) rather than once per call. parentType, when set, keeps only parents of that type.
+// Objects whose type has no parent relation (or none admitting parentType)
+// are not read at all: SpiceDB rejects a filter on a relation the schema
+// lacks. The first failed read cancels the rest.
+func (a *Authorizer) readParents(ctx context.Context, s *Schema, objects []string, parentType string) (map[string][]string, error) {
+	return a.readNeighbours(ctx, "read parent relationships", objects, func(typ, id string) []*v1.RelationshipFilter {
+		if !s.hasParentRelation(typ, parentType) {
+			return nil
+		}
+		filter := &v1.RelationshipFilter{ResourceType: typ, OptionalResourceId: id, OptionalRelation: "parent"}
+		if parentType != "" {
+			filter.OptionalSubjectFilter = &v1.SubjectFilter{SubjectType: parentType}
+		}
+		return []*v1.RelationshipFilter{filter}
+	}, func(r Relationship) string {
+		return r.SubjectType + ":" + r.SubjectID
+	})
+}
+
+// readChildren is readParents the other way round: the objects whose parent
+// is each of objects, read with one filtered ReadRelationships per object and
+// per type whose parent relation admits it.
+func (a *Authorizer) readChildren(ctx context.Context, s *Schema, objects []string) (map[string][]string, error) {
+	return a.readNeighbours(ctx, "read child relationships", objects, func(typ, id string) []*v1.RelationshipFilter {
+		var filters []*v1.RelationshipFilter
+		for _, child := range s.DefinitionOrder {
+			if s.hasParentRelation(child, typ) {
+				filters = append(filters, &v1.RelationshipFilter{
+					ResourceType:          child,
+					OptionalRelation:      "parent",
+					OptionalSubjectFilter: &v1.SubjectFilter{SubjectType: typ, OptionalSubjectId: id},
+				})
+			}
+		}
+		return filters
+	}, func(r Relationship) string {
+		return r.ResourceType + ":" + r.ResourceID
+	})
+}
+
+// readNeighbours runs the reads filters plans for each object, at most
+// a.lookupConcurrency at a time, and collects the other end of every parent
+// edge found, as named by neighbour.
+func (a *Authorizer) readNeighbours(ctx context.Context, op string, objects []string, filters func(typ, id string) []*v1.RelationshipFilter, neighbour func(Relationship) string) (map[string][]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cons := a.consistency(ctx)
+
+	type read struct {
+		obj    int
+		filter *v1.RelationshipFilter
+	}
+	var reads []read
+	for i, obj := range objects {
+		typ, id, _ := strings.Cut(obj, ":")
+		for _, f := range filters(typ, id) {
+			reads = append(reads, read{i, f})
+		}
+	}
+
+	n := a.lookupConcurrency
+	if n <= 0 {
+		n = 1
+	}
+	found := make([][]string, len(reads))
+	sem := make(chan struct{}, n)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i, rd := range reads {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, filter *v1.RelationshipFilter) {
+			defer func() { <-sem; wg.Done() }()
+			err := a.readRelationships(ctx, filter, cons, func(rel *v1.Relationship) error {
+				if r := RelationshipFromProto(rel); isParentEdge(r) {
+					found[i] = append(found[i], neighbour(r))
+				}
+				return nil
+			})
+			if err != nil {
+				errOnce.Do(func() { firstErr = err; cancel() })
+			}
+		}(i, rd.filter)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		// Cancelled by the caller: the objects not yet read would
+		// otherwise look unconnected.
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return nil, wrapErr(op, firstErr)
+	}
+
+	out := make(map[string][]string, len(objects))
+	for i, rd := range reads {
+		if len(found[i]) > 0 {
+			obj := objects[rd.obj]
+			out[obj] = append(out[obj], found[i]...)
+		}
+	}
+	return out, nil
+}
+
+// hasParentRelation reports whether typ has a parent relation, admitting
+// parentType if that is set.
+func (s *Schema) hasParentRelation(typ, parentType string) bool {
+	def := s.Definitions[typ]
+	if def == nil || def.Relations["parent"] == nil {
+		return false
+	}
+	return parentType == "" || allowsType(def.Relations["parent"], parentType)
+}
+
+// liveSchema returns the schema deployed in SpiceDB, or the embedded
+// schema.zed when a has no schema client to ask. It costs a ReadSchema and
+// a parse, so each lookup or write check calls it once and passes the
+// result down.
+func (a *Authorizer) liveSchema(ctx context.Context) (*Schema, error) {
+	if a.schema == nil {
+		return DefaultTranslator().schema, nil
+	}
+	src, err := a.ReadSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseSchema(src)
+	if err != nil {
+		return nil, &Error{Op: "read schema", Err: err}
+	}
+	return s, nil
+}
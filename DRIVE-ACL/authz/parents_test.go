@@ -0,0 +1,154 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// readHook records the filter of each ReadRelationships call before it
+// reaches the MemoryClient.
+type readHook struct {
+	*MemoryClient
+	filters []*v1.RelationshipFilter
+	before  func()
+}
+
+func (r *readHook) ReadRelationships(ctx context.Context, in *v1.ReadRelationshipsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[v1.ReadRelationshipsResponse], error) {
+	r.filters = append(r.filters, in.RelationshipFilter)
+	if r.before != nil {
+		r.before()
+	}
+	return r.MemoryClient.ReadRelationships(ctx, in, opts...)
+}
+
+func TestReadParents(t *testing.T) {
+	mc := newEvalClient(t,
+		"folder:f#parent@folder:p",
+		"folder:f#parent@folder:q",
+		"folder:p#viewer@user:u",
+	)
+	hook := &readHook{MemoryClient: mc}
+	a := NewAuthorizer(hook, WithLookupConcurrency(1))
+
+	got, err := a.readParents(context.Background(), mc.Schema(), []string{"folder:f", "folder:p", "group:g", "user:u"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]string{"folder:f": {"folder:p", "folder:q"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parents = %v, want %v", got, want)
+	}
+	// group and user have no parent relation, so they are not read.
+	if len(hook.filters) != 2 {
+		t.Errorf("%d reads, want 2 (one per folder)", len(hook.filters))
+	}
+	for _, f := range hook.filters {
+		if f.ResourceType != "folder" || f.OptionalRelation != "parent" || f.OptionalResourceId == "" {
+			t.Errorf("unexpected filter %v", f)
+		}
+	}
+
+	// No type but folder may be a folder's parent.
+	hook.filters = nil
+	got, err = a.readParents(context.Background(), mc.Schema(), []string{"folder:f"}, "group")
+	if err != nil || len(got) != 0 || len(hook.filters) != 0 {
+		t.Errorf("parent type group: got %v, %v after %d reads; want nothing read", got, err, len(hook.filters))
+	}
+}
+
+func TestReadParentsCancelled(t *testing.T) {
+	objects := []string{"folder:a", "folder:b", "folder:c"}
+	mc := newEvalClient(t, "folder:a#parent@folder:p", "folder:b#parent@folder:p", "folder:c#parent@folder:p")
+
+	t.Run("before", func(t *testing.T) {
+		a := NewAuthorizer(mc)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		got, err := a.readParents(ctx, mc.Schema(), objects, "")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, %v; want context.Canceled", got, err)
+		}
+	})
+
+	t.Run("during", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		hook := &readHook{MemoryClient: mc, before: cancel}
+		a := NewAuthorizer(hook, WithLookupConcurrency(1))
+		got, err := a.readParents(ctx, mc.Schema(), objects, "")
+		if err == nil {
+			t.Fatalf("got %v with no error after %d of %d reads", got, len(hook.filters), len(objects))
+		}
+	})
+}
+
+func TestMemoryReadRejectsUnknownNames(t *testing.T) {
+	mc := newEvalClient(t)
+	tests := []*v1.RelationshipFilter{
+		{ResourceType: "nope"},
+		{ResourceType: "group", OptionalRelation: "parent"},
+		{ResourceType: "folder", OptionalSubjectFilter: &v1.SubjectFilter{SubjectType: "nope"}},
+		{ResourceType: "folder", OptionalSubjectFilter: &v1.SubjectFilter{SubjectType: "group", OptionalRelation: &v1.SubjectFilter_RelationFilter{Relation: "nope"}}},
+	}
+	for _, f := range tests {
+		_, err := mc.ReadRelationships(context.Background(), &v1.ReadRelationshipsRequest{RelationshipFilter: f})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("read %v: err = %v, want FailedPrecondition", f, err)
+		}
+		_, err = mc.DeleteRelationships(context.Background(), &v1.DeleteRelationshipsRequest{RelationshipFilter: f})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("delete %v: err = %v, want FailedPrecondition", f, err)
+		}
+	}
+
+	// Permissions may be filtered on, as SpiceDB allows.
+	ok := &v1.RelationshipFilter{ResourceType: "folder", OptionalRelation: "viewer", OptionalSubjectFilter: &v1.SubjectFilter{SubjectType: "group", OptionalRelation: &v1.SubjectFilter_RelationFilter{Relation: "member"}}}
+	if _, err := mc.ReadRelationships(context.Background(), &v1.ReadRelationshipsRequest{RelationshipFilter: ok}); err != nil {
+		t.Errorf("read %v: %v", ok, err)
+	}
+}
+
+// schemaReads counts the ReadSchema calls reaching the MemoryClient.
+type schemaReads struct {
+	*MemoryClient
+	n int
+}
+
+func (s *schemaReads) ReadSchema(ctx context.Context, in *v1.ReadSchemaRequest, opts ...grpc.CallOption) (*v1.ReadSchemaResponse, error) {
+	s.n++
+	return s.MemoryClient.ReadSchema(ctx, in, opts...)
+}
+
+func TestLiveSchemaReadOncePerCall(t *testing.T) {
+	mc := newEvalClient(t,
+		"folder:a#parent@folder:b",
+		"folder:b#parent@folder:c",
+		"folder:c#parent@folder:d",
+		"folder:a#viewer@user:u",
+	)
+	reads := &schemaReads{MemoryClient: mc}
+	a := NewAuthorizer(reads)
+	ctx := context.Background()
+
+	// Three levels up from a for the subtree, three down from a new parent
+	// of d for the write check: one schema read each.
+	if _, err := a.ListResourceSubtree(ctx, "folder", "d", "view", "user", "u", "folder"); err != nil {
+		t.Fatal(err)
+	}
+	if reads.n != 1 {
+		t.Errorf("subtree read the schema %d times, want 1", reads.n)
+	}
+	reads.n = 0
+	if _, err := a.WriteRelationships(ctx, parseRels(t, "folder:d#parent@folder:e")); err != nil {
+		t.Fatal(err)
+	}
+	if reads.n != 1 {
+		t.Errorf("write check read the schema %d times, want 1", reads.n)
+	}
+}
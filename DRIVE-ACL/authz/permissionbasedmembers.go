@@ -2,16 +2,27 @@ package authz
 
 import (
 	"context"
-	"fmt"
 	"io"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 )
 
 func GetEffectiveSubjects(resourceType, resourceID, permission, subjectType string) ([]string, error) {
-	ctx := context.Background()
+	return GetEffectiveSubjectsContext(Context(), resourceType, resourceID, permission, subjectType)
+}
+
+func GetEffectiveSubjectsContext(ctx context.Context, resourceType, resourceID, permission, subjectType string) ([]string, error) {
+	return Default().GetEffectiveSubjects(ctx, resourceType, resourceID, permission, subjectType)
+}
+
+// GetEffectiveSubjects returns every subject of subjectType that computes to
+// permission on the resource.
+func (a *Authorizer) GetEffectiveSubjects(ctx context.Context, resourceType, resourceID, permission, subjectType string) ([]string, error) {
+	ctx, alive, cancel := a.streamContext(ctx)
+	defer cancel()
 
-	resp, err := Client.LookupSubjects(ctx, &v1.LookupSubjectsRequest{
+	resp, err := a.client.LookupSubjects(ctx, &v1.LookupSubjectsRequest{
+		Consistency: a.consistency(ctx),
 		Resource: &v1.ObjectReference{
 			ObjectType: resourceType,
 			ObjectId:   resourceID,
@@ -20,7 +31,7 @@ func GetEffectiveSubjects(resourceType, resourceID, permission, subjectType stri
 		SubjectObjectType: subjectType,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to lookup subjects: %w", err)
+		return nil, wrapErr("lookup subjects", streamErr(ctx, err))
 	}
 
 	var subjects []string
@@ -30,8 +41,9 @@ func GetEffectiveSubjects(resourceType, resourceID, permission, subjectType stri
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("recv failed: %w", err)
+			return nil, wrapErr("lookup subjects", streamErr(ctx, err))
 		}
+		alive()
 		if sub.Subject != nil {
 			subjects = append(subjects, sub.Subject.SubjectObjectId)
 		}
@@ -0,0 +1,247 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// MaxWriteUpdates is the most updates SpiceDB accepts in one
+// WriteRelationships call by default. Reconcile writes a plan that fits in
+// one call atomically.
+const MaxWriteUpdates = 1000
+
+// ReconcileOptions controls Reconcile.
+type ReconcileOptions struct {
+	// DryRun computes the plan without writing anything.
+	DryRun bool
+	// ResourceTypes are the object types the config owns. Every stored
+	// relationship on them that the config does not produce is deleted.
+	// Empty means the resource types that appear in the desired set.
+	ResourceTypes []string
+	// AllowEmpty lets an empty desired set through. Without it Reconcile
+	// refuses one, since it would delete everything of ResourceTypes.
+	AllowEmpty bool
+	// AllowPartial lets a plan of more than MaxWriteUpdates updates be
+	// applied in several writes of BatchSize, removes first. Each write is
+	// atomic but the plan as a whole is not: a failure part way leaves the
+	// earlier writes in place. Without it such a plan is refused before
+	// anything is written.
+	AllowPartial bool
+	// BatchSize is the number of updates per write with AllowPartial; zero
+	// means DefaultBatchSize. Keep it under SpiceDB's per-request limit.
+	BatchSize int
+}
+
+// ReconcilePlan is what Reconcile changed, or would change on a dry run.
+type ReconcilePlan struct {
+	Add       []Relationship `json:"add"`
+	Update    []Relationship `json:"update"` // same tuple, different caveat or expiration
+	Remove    []Relationship `json:"remove"`
+	Unchanged int            `json:"unchanged"`
+	DryRun    bool           `json:"dry_run"`
+	Written   int            `json:"written"` // updates applied, counting all three lists
+	WrittenAt string         `json:"zed_token,omitempty"`
+}
+
+// Empty reports whether SpiceDB already matches the desired state.
+func (p *ReconcilePlan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Update) == 0 && len(p.Remove) == 0
+}
+
+func Reconcile(desired []Relationship, opts ReconcileOptions) (*ReconcilePlan, error) {
+	return ReconcileContext(Context(), desired, opts)
+}
+
+func ReconcileContext(ctx context.Context, desired []Relationship, opts ReconcileOptions) (*ReconcilePlan, error) {
+	return Default().Reconcile(ctx, desired, opts)
+}
+
+// Reconcile makes the managed resource types in SpiceDB hold exactly the
+// desired relationships. It reads the current state fully consistently,
+// works out the TOUCH and DELETE updates that close the gap and applies them
+// in one WriteRelationships, so the plan goes through whole or not at all.
+// The write carries preconditions that what it adds is still absent and
+// what it updates still present, so a concurrent writer makes it fail with
+// ErrConflict instead of being overwritten.
+//
+// A plan of more than MaxWriteUpdates updates does not fit in one write and
+// fails with ErrInvalidArgument unless opts.AllowPartial is set. It is then
+// applied in chunks of opts.BatchSize, removes before updates before adds so
+// that a failure part way never leaves more access than before. A failed
+// chunk leaves the earlier ones applied; plan.Written says how many updates
+// went through, and running Reconcile again finishes the job.
+func (a *Authorizer) Reconcile(ctx context.Context, desired []Relationship, opts ReconcileOptions) (*ReconcilePlan, error) {
+	if len(desired) == 0 && !opts.AllowEmpty && !opts.DryRun {
+		return nil, &Error{Op: "reconcile", Kind: ErrInvalidArgument, Err: errors.New("empty desired set would delete every managed relationship; set AllowEmpty to allow it")}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if herr := findHierarchyIssues(desired, a.maxDepth); herr != nil {
+		return nil, &Error{Op: "reconcile", Kind: ErrInvalidArgument, Err: herr}
+	}
+	want := make(map[string]Relationship, len(desired))
+	for _, r := range desired {
+		want[r.Key()] = r
+	}
+	types := opts.ResourceTypes
+	if len(types) == 0 {
+		seen := map[string]bool{}
+		for _, r := range desired {
+			if !seen[r.ResourceType] {
+				seen[r.ResourceType] = true
+				types = append(types, r.ResourceType)
+			}
+		}
+	}
+
+	have := map[string]Relationship{}
+	for _, typ := range types {
+		err := a.readRelationships(ctx, &v1.RelationshipFilter{ResourceType: typ}, FullyConsistent().proto(), func(rel *v1.Relationship) error {
+			r := RelationshipFromProto(rel)
+			have[r.Key()] = r
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &ReconcilePlan{DryRun: opts.DryRun}
+	for k, r := range want {
+		cur, ok := have[k]
+		switch {
+		case !ok:
+			plan.Add = append(plan.Add, r)
+		case cur.String() != r.String():
+			plan.Update = append(plan.Update, r)
+		default:
+			plan.Unchanged++
+		}
+	}
+	for k, r := range have {
+		if _, ok := want[k]; !ok {
+			plan.Remove = append(plan.Remove, r)
+		}
+	}
+	sortRelationships(plan.Add)
+	sortRelationships(plan.Update)
+	sortRelationships(plan.Remove)
+	if opts.DryRun || plan.Empty() {
+		return plan, nil
+	}
+	total := len(plan.Add) + len(plan.Update) + len(plan.Remove)
+	batch := total
+	if total > MaxWriteUpdates {
+		if !opts.AllowPartial {
+			return plan, &Error{Op: "reconcile", Kind: ErrInvalidArgument, Err: fmt.Errorf("%d updates do not fit in one write of at most %d; set AllowPartial to apply them in several", total, MaxWriteUpdates)}
+		}
+		batch = opts.BatchSize
+	}
+
+	var updates []*v1.RelationshipUpdate
+	var pre []*v1.Precondition // pre[i] guards updates[i]; nil for removes
+	for _, group := range []struct {
+		op   v1.RelationshipUpdate_Operation
+		rels []Relationship
+		want v1.Precondition_Operation
+	}{
+		{v1.RelationshipUpdate_OPERATION_DELETE, plan.Remove, v1.Precondition_OPERATION_UNSPECIFIED},
+		{v1.RelationshipUpdate_OPERATION_TOUCH, plan.Update, v1.Precondition_OPERATION_MUST_MATCH},
+		{v1.RelationshipUpdate_OPERATION_TOUCH, plan.Add, v1.Precondition_OPERATION_MUST_NOT_MATCH},
+	} {
+		for _, r := range group.rels {
+			rel, err := r.Proto()
+			if err != nil {
+				return plan, err
+			}
+			updates = append(updates, &v1.RelationshipUpdate{Operation: group.op, Relationship: rel})
+			if group.want == v1.Precondition_OPERATION_UNSPECIFIED {
+				pre = append(pre, nil)
+			} else {
+				pre = append(pre, &v1.Precondition{Operation: group.want, Filter: exactFilter(r)})
+			}
+		}
+	}
+
+	for off := 0; off < len(updates); off += batch {
+		end := min(off+batch, len(updates))
+		var conds []*v1.Precondition
+		for _, p := range pre[off:end] {
+			if p != nil {
+				conds = append(conds, p)
+			}
+		}
+		written, err := a.writeGuarded(ctx, updates[off:end], conds)
+		if err != nil {
+			return plan, &Error{Op: "reconcile", Kind: kindOf(err), Err: fmt.Errorf("after %d of %d updates: %w", plan.Written, len(updates), err)}
+		}
+		plan.Written = end
+		plan.WrittenAt = written
+	}
+	return plan, nil
+}
+
+// writeGuarded applies updates atomically, provided pre all hold.
+func (a *Authorizer) writeGuarded(ctx context.Context, updates []*v1.RelationshipUpdate, pre []*v1.Precondition) (string, error) {
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+	resp, err := a.client.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{Updates: updates, OptionalPreconditions: pre})
+	if err != nil {
+		return "", err
+	}
+	return zedToken(resp.WrittenAt), nil
+}
+
+// exactFilter matches r's tuple and nothing else.
+func exactFilter(r Relationship) *v1.RelationshipFilter {
+	return &v1.RelationshipFilter{
+		ResourceType:       r.ResourceType,
+		OptionalResourceId: r.ResourceID,
+		OptionalRelation:   r.Relation,
+		OptionalSubjectFilter: &v1.SubjectFilter{
+			SubjectType:       r.SubjectType,
+			OptionalSubjectId: r.SubjectID,
+			OptionalRelation:  &v1.SubjectFilter_RelationFilter{Relation: r.SubjectRelation},
+		},
+	}
+}
+
+// readRelationships streams every relationship matching filter into fn. The
+// default timeout applies to each message, not the whole read (see
+// streamContext), so a full scan of a large store can run as long as it
+// keeps making progress.
+func (a *Authorizer) readRelationships(ctx context.Context, filter *v1.RelationshipFilter, c *v1.Consistency, fn func(*v1.Relationship) error) error {
+	ctx, alive, cancel := a.streamContext(ctx)
+	defer cancel()
+
+	stream, err := a.client.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
+		Consistency:        c,
+		RelationshipFilter: filter,
+	})
+	if err != nil {
+		return wrapErr("read relationships", streamErr(ctx, err))
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return wrapErr("read relationships", streamErr(ctx, err))
+		}
+		alive()
+		if err := fn(resp.Relationship); err != nil {
+			return err
+		}
+	}
+}
+
+func sortRelationships(rels []Relationship) {
+	sort.Slice(rels, func(i, j int) bool { return rels[i].Key() < rels[j].Key() })
+}
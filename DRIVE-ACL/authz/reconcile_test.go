@@ -0,0 +1,268 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// writeHook runs before each WriteRelationships reaches the MemoryClient.
+type writeHook struct {
+	*MemoryClient
+	writes int
+	before func(n int)
+}
+
+func (w *writeHook) WriteRelationships(ctx context.Context, in *v1.WriteRelationshipsRequest, opts ...grpc.CallOption) (*v1.WriteRelationshipsResponse, error) {
+	w.writes++
+	if w.before != nil {
+		w.before(w.writes)
+	}
+	return w.MemoryClient.WriteRelationships(ctx, in, opts...)
+}
+
+func parseRels(t *testing.T, lines ...string) []Relationship {
+	t.Helper()
+	rels, errs := ParseRelationships(lines)
+	if len(errs) > 0 {
+		t.Fatalf("parse: %+v", errs)
+	}
+	return rels
+}
+
+func storedKeys(t *testing.T, mc *MemoryClient, typ string) map[string]bool {
+	t.Helper()
+	a := NewAuthorizer(mc)
+	keys := map[string]bool{}
+	err := a.readRelationships(context.Background(), &v1.RelationshipFilter{ResourceType: typ}, FullyConsistent().proto(), func(rel *v1.Relationship) error {
+		keys[RelationshipFromProto(rel).Key()] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestReconcileAtomic(t *testing.T) {
+	var desired []string
+	for i := 0; i < 5; i++ {
+		desired = append(desired, fmt.Sprintf("folder:f%d#viewer@user:u", i))
+	}
+	desired = append(desired, "folder:keep#viewer@user:u")
+
+	t.Run("one write", func(t *testing.T) {
+		mc := newEvalClient(t, "folder:old#viewer@user:u", "folder:keep#viewer@user:u")
+		hook := &writeHook{MemoryClient: mc}
+		// BatchSize only applies with AllowPartial.
+		plan, err := NewAuthorizer(hook).Reconcile(context.Background(), parseRels(t, desired...), ReconcileOptions{BatchSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan.Add) != 5 || len(plan.Remove) != 1 || plan.Unchanged != 1 {
+			t.Errorf("plan = %d add, %d remove, %d unchanged; want 5, 1, 1", len(plan.Add), len(plan.Remove), plan.Unchanged)
+		}
+		if hook.writes != 1 || plan.Written != 6 {
+			t.Errorf("wrote %d updates in %d calls, want 6 in 1", plan.Written, hook.writes)
+		}
+		got := storedKeys(t, mc, "folder")
+		if len(got) != 6 || got["folder:old#viewer@user:u"] {
+			t.Errorf("stored %v, want exactly the desired set", got)
+		}
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		mc := newEvalClient(t, "folder:old#viewer@user:u", "folder:keep#viewer@user:u")
+		hook := &writeHook{MemoryClient: mc}
+		hook.before = func(int) {
+			// Someone else adds the last of the new grants first.
+			if _, err := mc.WriteRelationships(context.Background(), &v1.WriteRelationshipsRequest{Updates: []*v1.RelationshipUpdate{{
+				Operation:    v1.RelationshipUpdate_OPERATION_TOUCH,
+				Relationship: mustProto(t, "folder:f4#viewer@user:u"),
+			}}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		plan, err := NewAuthorizer(hook).Reconcile(context.Background(), parseRels(t, desired...), ReconcileOptions{})
+		if !errors.Is(err, ErrConflict) || plan.Written != 0 {
+			t.Fatalf("got %+v, %v; want ErrConflict with nothing written", plan, err)
+		}
+		got := storedKeys(t, mc, "folder")
+		if len(got) != 3 || !got["folder:old#viewer@user:u"] {
+			t.Errorf("stored %v, want the old state plus the concurrent write", got)
+		}
+	})
+}
+
+func TestReconcileChunks(t *testing.T) {
+	var desired []string
+	for i := 0; i < MaxWriteUpdates; i++ {
+		desired = append(desired, fmt.Sprintf("folder:f%d#viewer@user:u", i))
+	}
+
+	mc := newEvalClient(t, "folder:old#viewer@user:u")
+	hook := &writeHook{MemoryClient: mc}
+	a := NewAuthorizer(hook)
+
+	// 1001 updates do not fit in one write.
+	_, err := a.Reconcile(context.Background(), parseRels(t, desired...), ReconcileOptions{})
+	if !errors.Is(err, ErrInvalidArgument) || hook.writes != 0 {
+		t.Fatalf("err = %v after %d writes, want ErrInvalidArgument and none", err, hook.writes)
+	}
+
+	hook.before = func(n int) {
+		// Removes go first, so the first write takes the old grant away.
+		if n == 2 && storedKeys(t, mc, "folder")["folder:old#viewer@user:u"] {
+			t.Error("old relationship still stored after the first write")
+		}
+	}
+	plan, err := a.Reconcile(context.Background(), parseRels(t, desired...), ReconcileOptions{AllowPartial: true, BatchSize: 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.writes != 3 || plan.Written != MaxWriteUpdates+1 {
+		t.Errorf("wrote %d updates in %d calls, want %d in 3", plan.Written, hook.writes, MaxWriteUpdates+1)
+	}
+	if got := storedKeys(t, mc, "folder"); len(got) != MaxWriteUpdates || got["folder:old#viewer@user:u"] {
+		t.Errorf("stored %d relationships, want exactly the desired set", len(got))
+	}
+}
+
+func TestReconcileRefusesEmpty(t *testing.T) {
+	mc := newEvalClient(t, "folder:f#viewer@user:u")
+	a := NewAuthorizer(mc)
+	opts := ReconcileOptions{ResourceTypes: []string{"folder"}}
+
+	if _, err := a.Reconcile(context.Background(), nil, opts); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("err = %v, want ErrInvalidArgument", err)
+	}
+	if len(storedKeys(t, mc, "folder")) != 1 {
+		t.Fatal("refused reconcile deleted relationships")
+	}
+
+	opts.DryRun = true
+	if plan, err := a.Reconcile(context.Background(), nil, opts); err != nil || len(plan.Remove) != 1 {
+		t.Fatalf("dry run = %+v, %v; want a plan removing 1", plan, err)
+	}
+
+	opts.DryRun, opts.AllowEmpty = false, true
+	if _, err := a.Reconcile(context.Background(), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(storedKeys(t, mc, "folder")); n != 0 {
+		t.Errorf("%d relationships left, want 0", n)
+	}
+}
+
+func TestReconcileConflict(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     []string
+		desired    []string
+		concurrent *v1.RelationshipUpdate
+	}{
+		{
+			name:    "added concurrently",
+			desired: []string{`folder:f#reader@user:u[in_hours:{"hour":10}]`},
+			concurrent: &v1.RelationshipUpdate{
+				Operation:    v1.RelationshipUpdate_OPERATION_TOUCH,
+				Relationship: mustProto(t, "folder:f#reader@user:u[in_hours]"),
+			},
+		},
+		{
+			name:    "deleted concurrently",
+			stored:  []string{"folder:f#reader@user:u[in_hours]"},
+			desired: []string{`folder:f#reader@user:u[in_hours:{"hour":10}]`},
+			concurrent: &v1.RelationshipUpdate{
+				Operation:    v1.RelationshipUpdate_OPERATION_DELETE,
+				Relationship: mustProto(t, "folder:f#reader@user:u[in_hours]"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := newEvalClient(t, tt.stored...)
+			hook := &writeHook{MemoryClient: mc}
+			hook.before = func(int) {
+				if _, err := mc.WriteRelationships(context.Background(), &v1.WriteRelationshipsRequest{Updates: []*v1.RelationshipUpdate{tt.concurrent}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := NewAuthorizer(hook).Reconcile(context.Background(), parseRels(t, tt.desired...), ReconcileOptions{})
+			if !errors.Is(err, ErrConflict) {
+				t.Fatalf("err = %v, want ErrConflict", err)
+			}
+		})
+	}
+}
+
+func mustProto(t *testing.T, line string) *v1.Relationship {
+	t.Helper()
+	rel, err := MustParseRelationship(line).Proto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rel
+}
+
+// slowReads delays every message of a ReadRelationships stream.
+type slowReads struct {
+	*MemoryClient
+	delay func(n int) time.Duration
+}
+
+type slowStream struct {
+	grpc.ServerStreamingClient[v1.ReadRelationshipsResponse]
+	ctx   context.Context
+	delay func(n int) time.Duration
+	n     int
+}
+
+func (s *slowReads) ReadRelationships(ctx context.Context, in *v1.ReadRelationshipsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[v1.ReadRelationshipsResponse], error) {
+	stream, err := s.MemoryClient.ReadRelationships(ctx, in, opts...)
+	return &slowStream{ServerStreamingClient: stream, ctx: ctx, delay: s.delay}, err
+}
+
+func (s *slowStream) Recv() (*v1.ReadRelationshipsResponse, error) {
+	s.n++
+	select {
+	case <-time.After(s.delay(s.n)):
+	case <-s.ctx.Done():
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	}
+	return s.ServerStreamingClient.Recv()
+}
+
+func TestReadRelationshipsIdleTimeout(t *testing.T) {
+	var rels []string
+	for i := 0; i < 10; i++ {
+		rels = append(rels, fmt.Sprintf("folder:f%d#viewer@user:u", i))
+	}
+	mc := newEvalClient(t, rels...)
+	read := func(a *Authorizer) error {
+		return a.readRelationships(context.Background(), &v1.RelationshipFilter{ResourceType: "folder"}, FullyConsistent().proto(), func(*v1.Relationship) error { return nil })
+	}
+
+	// 10 messages 20ms apart outlast the 100ms timeout but never go quiet
+	// for that long.
+	steady := NewAuthorizer(&slowReads{MemoryClient: mc, delay: func(int) time.Duration { return 20 * time.Millisecond }}, WithTimeout(100*time.Millisecond))
+	if err := read(steady); err != nil {
+		t.Fatalf("steady stream: %v", err)
+	}
+
+	stalled := NewAuthorizer(&slowReads{MemoryClient: mc, delay: func(n int) time.Duration {
+		if n == 5 {
+			return time.Second
+		}
+		return 0
+	}}, WithTimeout(100*time.Millisecond))
+	if err := read(stalled); !errors.Is(err, ErrUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("stalled stream: err = %v, want ErrUnavailable", err)
+	}
+}
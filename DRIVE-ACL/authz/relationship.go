@@ -0,0 +1,356 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Relationship is one SpiceDB tuple. Its string form is the one zed and the
+// SpiceDB playground use:
+//
+//	resource_type:resource_id#relation@subject_type:subject_id[#subject_relation][[caveat[:{json}]]][[expiration:RFC3339]]
+type Relationship struct {
+	ResourceType    string
+	ResourceID      string
+	Relation        string
+	SubjectType     string
+	SubjectID       string // "*" for a wildcard
+	SubjectRelation string // "" for a plain subject
+
+	Caveat        string
+	CaveatContext map[string]interface{}
+	Expiration    time.Time // zero means the relationship does not expire
+}
+
+// RelationshipSyntaxError is a relationship string that does not parse. It
+// matches ErrInvalidArgument with errors.Is.
+type RelationshipSyntaxError struct {
+	Input string
+	Pos   int // byte offset of the problem
+	Msg   string
+}
+
+func (e *RelationshipSyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d in %q", e.Msg, e.Pos, e.Input)
+}
+
+func (e *RelationshipSyntaxError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+// ParseRelationship parses the string form described on Relationship.
+func ParseRelationship(s string) (Relationship, error) {
+	p := &relParser{in: s}
+	var r Relationship
+	var err error
+
+	if r.ResourceType, err = p.typeName("resource type"); err != nil {
+		return Relationship{}, err
+	}
+	if err = p.expect(':'); err != nil {
+		return Relationship{}, err
+	}
+	if r.ResourceID, err = p.objectID("resource id", false, "#"); err != nil {
+		return Relationship{}, err
+	}
+	if err = p.expect('#'); err != nil {
+		return Relationship{}, err
+	}
+	if r.Relation, err = p.ident("relation"); err != nil {
+		return Relationship{}, err
+	}
+	if err = p.expect('@'); err != nil {
+		return Relationship{}, err
+	}
+	if r.SubjectType, err = p.typeName("subject type"); err != nil {
+		return Relationship{}, err
+	}
+	if err = p.expect(':'); err != nil {
+		return Relationship{}, err
+	}
+	if r.SubjectID, err = p.objectID("subject id", true, "#["); err != nil {
+		return Relationship{}, err
+	}
+	if p.peek() == '#' {
+		p.pos++
+		if strings.HasPrefix(p.in[p.pos:], "...") {
+			p.pos += 3 // "..." is SpiceDB's spelling of "no relation"
+		} else if r.SubjectRelation, err = p.ident("subject relation"); err != nil {
+			return Relationship{}, err
+		}
+		if r.SubjectID == "*" && r.SubjectRelation != "" {
+			return Relationship{}, p.errorf(p.pos, "wildcard subjects cannot have a relation")
+		}
+	}
+
+	if p.peek() == '[' && !strings.HasPrefix(p.in[p.pos:], "[expiration:") {
+		if err = p.caveat(&r); err != nil {
+			return Relationship{}, err
+		}
+	}
+	if p.peek() == '[' {
+		if err = p.expiration(&r); err != nil {
+			return Relationship{}, err
+		}
+	}
+	if p.pos < len(p.in) {
+		return Relationship{}, p.errorf(p.pos, "unexpected %q", p.in[p.pos:])
+	}
+	return r, nil
+}
+
+// MustParseRelationship is ParseRelationship for literals known to be valid.
+func MustParseRelationship(s string) Relationship {
+	r, err := ParseRelationship(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// String formats r so that ParseRelationship returns it unchanged.
+func (r Relationship) String() string {
+	var b strings.Builder
+	b.WriteString(r.ResourceType + ":" + r.ResourceID + "#" + r.Relation + "@" + r.SubjectType + ":" + r.SubjectID)
+	if r.SubjectRelation != "" {
+		b.WriteString("#" + r.SubjectRelation)
+	}
+	if r.Caveat != "" {
+		b.WriteString("[" + r.Caveat)
+		if len(r.CaveatContext) > 0 {
+			if ctx, err := json.Marshal(r.CaveatContext); err == nil {
+				b.WriteString(":" + string(ctx))
+			}
+		}
+		b.WriteString("]")
+	}
+	if !r.Expiration.IsZero() {
+		b.WriteString("[expiration:" + r.Expiration.UTC().Format(time.RFC3339Nano) + "]")
+	}
+	return b.String()
+}
+
+// Key identifies the tuple the way SpiceDB does: resource, relation and
+// subject, without caveat or expiration.
+func (r Relationship) Key() string {
+	k := r.ResourceType + ":" + r.ResourceID + "#" + r.Relation + "@" + r.SubjectType + ":" + r.SubjectID
+	if r.SubjectRelation != "" {
+		k += "#" + r.SubjectRelation
+	}
+	return k
+}
+
+// Subject formats the subject as "type:id" or "type:id#relation".
+func (r Relationship) Subject() string {
+	s := r.SubjectType + ":" + r.SubjectID
+	if r.SubjectRelation != "" {
+		s += "#" + r.SubjectRelation
+	}
+	return s
+}
+
+// MarshalText encodes r in its string form, so it reads naturally in JSON.
+func (r Relationship) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses the string form.
+func (r *Relationship) UnmarshalText(b []byte) error {
+	parsed, err := ParseRelationship(string(b))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Proto converts r for the SpiceDB API. It fails only if CaveatContext holds
+// values that have no JSON equivalent.
+func (r Relationship) Proto() (*v1.Relationship, error) {
+	rel := &v1.Relationship{
+		Resource: &v1.ObjectReference{ObjectType: r.ResourceType, ObjectId: r.ResourceID},
+		Relation: r.Relation,
+		Subject: &v1.SubjectReference{
+			Object:           &v1.ObjectReference{ObjectType: r.SubjectType, ObjectId: r.SubjectID},
+			OptionalRelation: r.SubjectRelation,
+		},
+	}
+	if r.Caveat != "" {
+		rel.OptionalCaveat = &v1.ContextualizedCaveat{CaveatName: r.Caveat}
+		if len(r.CaveatContext) > 0 {
+			ctx, err := structpb.NewStruct(r.CaveatContext)
+			if err != nil {
+				return nil, &Error{Op: "encode relationship", Kind: ErrInvalidArgument, Err: fmt.Errorf("%s: caveat context: %w", r.Key(), err)}
+			}
+			rel.OptionalCaveat.Context = ctx
+		}
+	}
+	if !r.Expiration.IsZero() {
+		rel.OptionalExpiresAt = timestamppb.New(r.Expiration)
+	}
+	return rel, nil
+}
+
+// RelationshipFromProto converts a relationship read from SpiceDB.
+func RelationshipFromProto(rel *v1.Relationship) Relationship {
+	r := Relationship{
+		ResourceType:    rel.GetResource().GetObjectType(),
+		ResourceID:      rel.GetResource().GetObjectId(),
+		Relation:        rel.GetRelation(),
+		SubjectType:     rel.GetSubject().GetObject().GetObjectType(),
+		SubjectID:       rel.GetSubject().GetObject().GetObjectId(),
+		SubjectRelation: rel.GetSubject().GetOptionalRelation(),
+	}
+	if c := rel.GetOptionalCaveat(); c != nil {
+		r.Caveat = c.CaveatName
+		if len(c.GetContext().GetFields()) > 0 {
+			r.CaveatContext = c.Context.AsMap()
+		}
+	}
+	if rel.OptionalExpiresAt != nil {
+		r.Expiration = rel.OptionalExpiresAt.AsTime()
+	}
+	return r
+}
+
+type relParser struct {
+	in  string
+	pos int
+}
+
+func (p *relParser) errorf(pos int, format string, args ...interface{}) error {
+	return &RelationshipSyntaxError{Input: p.in, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *relParser) peek() byte {
+	if p.pos < len(p.in) {
+		return p.in[p.pos]
+	}
+	return 0
+}
+
+func (p *relParser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.in) {
+			return p.errorf(p.pos, "expected %q, found end of input", c)
+		}
+		return p.errorf(p.pos, "expected %q, found %q", c, p.in[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+// ident reads a relation name: a lowercase letter, then lowercase letters,
+// digits and underscores.
+func (p *relParser) ident(what string) (string, error) {
+	start := p.pos
+	for p.pos < len(p.in) {
+		c := p.in[p.pos]
+		if !(c >= 'a' && c <= 'z' || p.pos > start && (c >= '0' && c <= '9' || c == '_')) {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf(start, "expected %s", what)
+	}
+	return p.in[start:p.pos], nil
+}
+
+// typeName reads a definition name, which may carry "prefix/" namespaces.
+func (p *relParser) typeName(what string) (string, error) {
+	start := p.pos
+	for {
+		if _, err := p.ident(what); err != nil {
+			return "", err
+		}
+		if p.peek() != '/' {
+			return p.in[start:p.pos], nil
+		}
+		p.pos++
+	}
+}
+
+func isObjectIDByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("/_|-=+", c) >= 0
+}
+
+// objectID reads an object id using SpiceDB's character set, up to one of
+// the terminator bytes or the end of input. Subjects may also be the "*"
+// wildcard.
+func (p *relParser) objectID(what string, allowWildcard bool, terminators string) (string, error) {
+	start := p.pos
+	if p.peek() == '*' {
+		if !allowWildcard {
+			return "", p.errorf(start, "%s cannot be a wildcard", what)
+		}
+		p.pos++
+		return "*", nil
+	}
+	for p.pos < len(p.in) && isObjectIDByte(p.in[p.pos]) {
+		p.pos++
+	}
+	if p.pos < len(p.in) && strings.IndexByte(terminators, p.in[p.pos]) < 0 {
+		return "", p.errorf(p.pos, "invalid character %q in %s", p.in[p.pos], what)
+	}
+	if p.pos == start {
+		return "", p.errorf(start, "expected %s", what)
+	}
+	return p.in[start:p.pos], nil
+}
+
+// caveat reads "[name]" or "[name:{json}]". Like definitions, caveats may be
+// namespaced: "ns/caveat".
+func (p *relParser) caveat(r *Relationship) error {
+	p.pos++ // "["
+	name, err := p.typeName("caveat name")
+	if err != nil {
+		return err
+	}
+	r.Caveat = name
+	if p.peek() == ':' {
+		p.pos++
+		start := p.pos
+		// The decoder stops after the object, which tells us where it ends.
+		dec := json.NewDecoder(strings.NewReader(p.in[p.pos:]))
+		dec.UseNumber() // keep integers above 2^53 exact
+		var ctx map[string]interface{}
+		if err := dec.Decode(&ctx); err != nil {
+			return p.errorf(start, "invalid caveat context: %v", err)
+		}
+		if ctx == nil {
+			return p.errorf(start, "caveat context must be a JSON object")
+		}
+		p.pos += int(dec.InputOffset())
+		r.CaveatContext = ctx
+	}
+	return p.expect(']')
+}
+
+// expiration reads "[expiration:2025-01-02T15:04:05Z]", with or without
+// fractional seconds.
+func (p *relParser) expiration(r *Relationship) error {
+	if !strings.HasPrefix(p.in[p.pos:], "[expiration:") {
+		return p.errorf(p.pos, "expected [expiration:...]")
+	}
+	p.pos += len("[expiration:")
+	start := p.pos
+	end := strings.IndexByte(p.in[p.pos:], ']')
+	if end < 0 {
+		return p.errorf(start, "unterminated expiration")
+	}
+	t, err := time.Parse(time.RFC3339, p.in[start:start+end])
+	if err != nil {
+		return p.errorf(start, "invalid expiration: %v", err)
+	}
+	r.Expiration = t
+	p.pos = start + end + 1
+	return nil
+}
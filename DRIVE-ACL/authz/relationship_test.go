@@ -0,0 +1,71 @@
+package authz
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelationshipRoundTrip(t *testing.T) {
+	tests := []string{
+		"partner:p1#user@users:alice",
+		"roles:admin#scope@feature:f1",
+		"page:p1#role@roles:admin#user",
+		"page:p1#public@users:*",
+		"partner:p1#user@users:alice[within_window]",
+		`partner:p1#user@users:alice[within_window:{"end_ts":20,"start_ts":10}]`,
+		"partner:p1#user@users:alice[expiration:2025-01-02T15:04:05Z]",
+		// Sub-second expirations keep every digit.
+		"partner:p1#user@users:alice[expiration:2025-01-02T15:04:05.123456789Z]",
+		// Namespaced caveat names, as SpiceDB allows.
+		"partner:p1#user@users:alice[acme/within_window]",
+		`partner:p1#user@users:alice[acme/within_window:{"start_ts":1}][expiration:2025-01-02T15:04:05.5Z]`,
+		// Integers above 2^53 stay exact.
+		`partner:p1#user@users:alice[within_window:{"start_ts":9007199254740993}]`,
+	}
+	for _, in := range tests {
+		r, err := ParseRelationship(in)
+		if err != nil {
+			t.Errorf("ParseRelationship(%q): %v", in, err)
+			continue
+		}
+		if got := r.String(); got != in {
+			t.Errorf("ParseRelationship(%q).String() = %q", in, got)
+		}
+		again, err := ParseRelationship(r.String())
+		if err != nil {
+			t.Errorf("ParseRelationship(%q): %v", r.String(), err)
+			continue
+		}
+		if again.Key() != r.Key() || !again.Expiration.Equal(r.Expiration) || again.Caveat != r.Caveat {
+			t.Errorf("%q does not survive a round trip: %+v != %+v", in, again, r)
+		}
+		if _, err := r.Proto(); err != nil {
+			t.Errorf("%q: Proto: %v", in, err)
+		}
+	}
+}
+
+func TestRelationshipStringSubSecondExpiration(t *testing.T) {
+	exp := time.Date(2025, 1, 2, 15, 4, 5, 250_000_000, time.UTC)
+	r := Relationship{ResourceType: "partner", ResourceID: "p1", Relation: "user", SubjectType: "users", SubjectID: "alice", Expiration: exp}
+	got, err := ParseRelationship(r.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Expiration.Equal(exp) {
+		t.Errorf("expiration = %v, want %v", got.Expiration, exp)
+	}
+}
+
+func TestParseRelationshipsCollectsErrors(t *testing.T) {
+	rels, errs := ParseRelationships([]string{"partner:p1#user@users:alice", "partner:p1#user", "nope"})
+	if len(rels) != 1 {
+		t.Errorf("got %d relationships, want 1", len(rels))
+	}
+	if len(errs) != 2 || errs[0].Line != 1 || errs[1].Line != 2 {
+		t.Fatalf("errors = %+v, want lines 1 and 2", errs)
+	}
+	if errs[0].Msg == "" || errs[0].Pos == 0 {
+		t.Errorf("error for line 1 lacks position or message: %+v", errs[0])
+	}
+}
@@ -0,0 +1,335 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OrphanPolicy decides what SyncSchema does when the new schema would leave
+// existing relationships without a relation or subject type to live in.
+type OrphanPolicy int
+
+const (
+	// OrphanRefuse returns an ErrSchemaMismatch error and leaves the deployed
+	// schema alone.
+	OrphanRefuse OrphanPolicy = iota
+	// OrphanWarn logs the orphans and leaves the deployed schema alone.
+	OrphanWarn
+)
+
+// ParseOrphanPolicy parses "refuse" or "warn".
+func ParseOrphanPolicy(s string) (OrphanPolicy, error) {
+	switch s {
+	case "refuse":
+		return OrphanRefuse, nil
+	case "warn":
+		return OrphanWarn, nil
+	}
+	return 0, &Error{Op: "parse orphan policy", Kind: ErrInvalidArgument, Err: fmt.Errorf("unknown policy %q (want refuse or warn)", s)}
+}
+
+// SchemaChange is one difference between two schemas.
+type SchemaChange struct {
+	Op     byte   // '+' added, '-' removed, '~' changed
+	Kind   string // "definition", "relation", "permission" or "caveat"
+	Name   string // "partner", "partner#view", "within_window"
+	Detail string // old → new for changes, the body for additions
+}
+
+func (c SchemaChange) String() string {
+	s := fmt.Sprintf("%c %s %s", c.Op, c.Kind, c.Name)
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	return s
+}
+
+// SchemaDiff lists the changes from a deployed schema to a desired one.
+type SchemaDiff struct {
+	Changes []SchemaChange
+}
+
+// Empty reports whether the schemas are equivalent.
+func (d *SchemaDiff) Empty() bool {
+	return d == nil || len(d.Changes) == 0
+}
+
+// String renders one change per line.
+func (d *SchemaDiff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	lines := make([]string, len(d.Changes))
+	for i, c := range d.Changes {
+		lines[i] = c.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffSchemas compares two parsed schemas. A nil schema counts as empty.
+func DiffSchemas(deployed, desired *Schema) *SchemaDiff {
+	if deployed == nil {
+		deployed = &Schema{}
+	}
+	if desired == nil {
+		desired = &Schema{}
+	}
+	d := &SchemaDiff{}
+	add := func(op byte, kind, name, detail string) {
+		d.Changes = append(d.Changes, SchemaChange{Op: op, Kind: kind, Name: name, Detail: detail})
+	}
+
+	for _, name := range deployed.DefinitionOrder {
+		if desired.Definitions[name] == nil {
+			add('-', "definition", name, "")
+		}
+	}
+	for _, name := range desired.DefinitionOrder {
+		nd, od := desired.Definitions[name], deployed.Definitions[name]
+		if od == nil {
+			add('+', "definition", name, "")
+			continue
+		}
+		for _, rn := range od.RelationOrder {
+			if nd.Relations[rn] == nil {
+				add('-', "relation", name+"#"+rn, relationTypes(od.Relations[rn]))
+			}
+		}
+		for _, pn := range od.PermissionOrder {
+			if nd.Permissions[pn] == nil {
+				add('-', "permission", name+"#"+pn, od.Permissions[pn].Expr.String())
+			}
+		}
+		for _, rn := range nd.RelationOrder {
+			nt := relationTypes(nd.Relations[rn])
+			switch or := od.Relations[rn]; {
+			case or == nil:
+				add('+', "relation", name+"#"+rn, nt)
+			case relationTypes(or) != nt:
+				add('~', "relation", name+"#"+rn, relationTypes(or)+" → "+nt)
+			}
+		}
+		for _, pn := range nd.PermissionOrder {
+			ne := nd.Permissions[pn].Expr.String()
+			switch op := od.Permissions[pn]; {
+			case op == nil:
+				add('+', "permission", name+"#"+pn, ne)
+			case op.Expr.String() != ne:
+				add('~', "permission", name+"#"+pn, op.Expr.String()+" → "+ne)
+			}
+		}
+	}
+
+	for _, name := range deployed.CaveatOrder {
+		if desired.Caveats[name] == nil {
+			add('-', "caveat", name, "")
+		}
+	}
+	for _, name := range desired.CaveatOrder {
+		nc, oc := desired.Caveats[name], deployed.Caveats[name]
+		switch {
+		case oc == nil:
+			add('+', "caveat", name, caveatSignature(nc))
+		case caveatSignature(oc) != caveatSignature(nc):
+			add('~', "caveat", name, caveatSignature(oc)+" → "+caveatSignature(nc))
+		}
+	}
+	return d
+}
+
+// relationTypes renders a relation's subject types in a canonical order.
+func relationTypes(r *RelationDef) string {
+	types := make([]string, len(r.Types))
+	for i, t := range r.Types {
+		types[i] = t.String()
+	}
+	sort.Strings(types)
+	return strings.Join(types, " | ")
+}
+
+func caveatSignature(c *CaveatDef) string {
+	params := make([]string, len(c.Params))
+	for i, p := range c.Params {
+		params[i] = p.Name + " " + p.Type
+	}
+	return "(" + strings.Join(params, ", ") + ") { " + strings.Join(strings.Fields(c.Expression), " ") + " }"
+}
+
+// SchemaPlan is the outcome of comparing the desired schema with SpiceDB.
+type SchemaPlan struct {
+	Diff *SchemaDiff
+	// Orphans lists one example relationship for each relation or subject
+	// type the new schema drops while data still uses it.
+	Orphans []string
+	// Applied is true once SyncSchema has written the schema.
+	Applied   bool
+	WrittenAt string
+}
+
+// ReadSchema returns the schema text deployed in SpiceDB, or "" if none has
+// been written yet.
+func (a *Authorizer) ReadSchema(ctx context.Context) (string, error) {
+	if a.schema == nil {
+		return "", &Error{Op: "read schema", Kind: ErrInvalidArgument, Err: errors.New("no schema client configured")}
+	}
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+
+	resp, err := a.schema.ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", wrapErr("read schema", err)
+	}
+	return resp.SchemaText, nil
+}
+
+// VerifySchema compares src with the deployed schema and looks for
+// relationships the change would orphan. It writes nothing.
+func (a *Authorizer) VerifySchema(ctx context.Context, src string) (*SchemaPlan, error) {
+	desired, err := ParseSchema(src)
+	if err != nil {
+		return nil, &Error{Op: "verify schema", Kind: ErrInvalidArgument, Err: err}
+	}
+	current, err := a.ReadSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deployed := &Schema{}
+	if current != "" {
+		if deployed, err = ParseSchema(current); err != nil {
+			return nil, &Error{Op: "verify schema", Kind: ErrSchemaMismatch, Err: fmt.Errorf("deployed schema: %w", err)}
+		}
+	}
+
+	plan := &SchemaPlan{Diff: DiffSchemas(deployed, desired)}
+	if plan.Diff.Empty() {
+		return plan, nil
+	}
+	plan.Orphans, err = a.findOrphans(ctx, deployed, desired)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// SyncSchema writes src to SpiceDB when it differs from the deployed schema.
+// If the change would orphan relationships, policy decides between failing
+// and logging; either way the deployed schema is left untouched.
+func (a *Authorizer) SyncSchema(ctx context.Context, src string, policy OrphanPolicy) (*SchemaPlan, error) {
+	plan, err := a.VerifySchema(ctx, src)
+	if err != nil || plan.Diff.Empty() {
+		return plan, err
+	}
+	if len(plan.Orphans) > 0 {
+		if policy == OrphanRefuse {
+			return plan, &Error{Op: "sync schema", Kind: ErrSchemaMismatch,
+				Err: fmt.Errorf("schema change would orphan relationships: %s", strings.Join(plan.Orphans, "; "))}
+		}
+		for _, o := range plan.Orphans {
+			a.logf("schema not applied, would orphan %s", o)
+		}
+		return plan, nil
+	}
+
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+	resp, err := a.schema.WriteSchema(ctx, &v1.WriteSchemaRequest{Schema: src})
+	if err != nil {
+		return plan, wrapErr("write schema", err)
+	}
+	plan.Applied = true
+	plan.WrittenAt = zedToken(resp.WrittenAt)
+	return plan, nil
+}
+
+// findOrphans checks every relation and subject type the deployed schema
+// has and desired lacks, reporting the first stored relationship that
+// desired would reject.
+func (a *Authorizer) findOrphans(ctx context.Context, deployed, desired *Schema) ([]string, error) {
+	var orphans []string
+	for _, dn := range deployed.DefinitionOrder {
+		od := deployed.Definitions[dn]
+		for _, rn := range od.RelationOrder {
+			var filters []*v1.RelationshipFilter
+			base := &v1.RelationshipFilter{ResourceType: dn, OptionalRelation: rn}
+			nr := desired.Relation(dn, rn)
+			if nr == nil {
+				filters = append(filters, base)
+			} else {
+				for _, t := range removedTypes(od.Relations[rn], nr) {
+					f := &v1.RelationshipFilter{ResourceType: dn, OptionalRelation: rn,
+						OptionalSubjectFilter: &v1.SubjectFilter{SubjectType: t.Type}}
+					if t.Wildcard {
+						f.OptionalSubjectFilter.OptionalSubjectId = "*"
+					}
+					if t.Relation != "" {
+						f.OptionalSubjectFilter.OptionalRelation = &v1.SubjectFilter_RelationFilter{Relation: t.Relation}
+					}
+					filters = append(filters, f)
+				}
+			}
+			for _, f := range filters {
+				o, err := a.firstInvalid(ctx, f, desired)
+				if err != nil {
+					return nil, err
+				}
+				if o != "" {
+					orphans = append(orphans, o)
+				}
+			}
+		}
+	}
+	return orphans, nil
+}
+
+func removedTypes(old, desired *RelationDef) []SubjectType {
+	kept := map[string]bool{}
+	for _, t := range desired.Types {
+		kept[t.String()] = true
+	}
+	var out []SubjectType
+	for _, t := range old.Types {
+		if !kept[t.String()] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// firstInvalid streams the relationships matching f and returns the first
+// one desired rejects, formatted with the reason, or "".
+func (a *Authorizer) firstInvalid(ctx context.Context, f *v1.RelationshipFilter, desired *Schema) (string, error) {
+	ctx, alive, cancel := a.streamContext(ctx)
+	defer cancel()
+
+	stream, err := a.client.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
+		Consistency:        FullyConsistent().proto(),
+		RelationshipFilter: f,
+	})
+	if err != nil {
+		return "", wrapErr("read relationships", streamErr(ctx, err))
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", wrapErr("read relationships", streamErr(ctx, err))
+		}
+		alive()
+		if verr := desired.ValidateRelationship(resp.Relationship); verr != nil {
+			return RelationshipFromProto(resp.Relationship).String() + " (" + status.Convert(verr).Message() + ")", nil
+		}
+	}
+}
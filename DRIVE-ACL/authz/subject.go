@@ -0,0 +1,90 @@
+package authz
+
+import (
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// ObjectReference names one object: "advertiser:123".
+type ObjectReference struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// SubjectReference names who a check is about: an object such as
+// "users:alice" or "superroot:root", or with Relation everyone holding that
+// relation on it, such as "roles:admin#user".
+type SubjectReference struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Relation string `json:"relation,omitempty"`
+}
+
+// User is the subject users:<id>, the one Check asks about.
+func User(id string) SubjectReference {
+	return SubjectReference{Type: "users", ID: id}
+}
+
+// ParseObjectReference parses "type:id".
+func ParseObjectReference(s string) (ObjectReference, error) {
+	p := &relParser{in: s}
+	var o ObjectReference
+	var err error
+	if o.Type, err = p.typeName("object type"); err != nil {
+		return ObjectReference{}, err
+	}
+	if err = p.expect(':'); err != nil {
+		return ObjectReference{}, err
+	}
+	if o.ID, err = p.objectID("object id", false, ""); err != nil {
+		return ObjectReference{}, err
+	}
+	return o, nil
+}
+
+// ParseSubjectReference parses "type:id" or "type:id#relation".
+func ParseSubjectReference(s string) (SubjectReference, error) {
+	p := &relParser{in: s}
+	var r SubjectReference
+	var err error
+	if r.Type, err = p.typeName("subject type"); err != nil {
+		return SubjectReference{}, err
+	}
+	if err = p.expect(':'); err != nil {
+		return SubjectReference{}, err
+	}
+	if r.ID, err = p.objectID("subject id", false, "#"); err != nil {
+		return SubjectReference{}, err
+	}
+	if p.peek() == '#' {
+		p.pos++
+		if r.Relation, err = p.ident("subject relation"); err != nil {
+			return SubjectReference{}, err
+		}
+	}
+	if p.pos < len(p.in) {
+		return SubjectReference{}, p.errorf(p.pos, "unexpected %q", p.in[p.pos:])
+	}
+	return r, nil
+}
+
+func (o ObjectReference) String() string {
+	return o.Type + ":" + o.ID
+}
+
+func (r SubjectReference) String() string {
+	if r.Relation != "" {
+		return r.Type + ":" + r.ID + "#" + r.Relation
+	}
+	return r.Type + ":" + r.ID
+}
+
+func (o ObjectReference) proto() *v1.ObjectReference {
+	return &v1.ObjectReference{ObjectType: o.Type, ObjectId: o.ID}
+}
+
+func (r SubjectReference) proto() *v1.SubjectReference {
+	return &v1.SubjectReference{
+		Object:           &v1.ObjectReference{ObjectType: r.Type, ObjectId: r.ID},
+		OptionalRelation: r.Relation,
+	}
+}
@@ -1,6 +1,7 @@
 package authz
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -36,13 +37,32 @@ func collectIDs(node *Node) []string {
 func GetAuthorizationTokenDataForSSOUserId(
 	ssoUserId int64, partnerID *int64,
 ) (*AuthorizationToken, error) {
-	fmt.Println("Generating authz token for SSO user:", ssoUserId, "partnerID filter:", partnerID)
+	return GetAuthorizationTokenDataForSSOUserIdContext(Context(), ssoUserId, partnerID)
+}
+
+func GetAuthorizationTokenDataForSSOUserIdContext(
+	ctx context.Context, ssoUserId int64, partnerID *int64,
+) (*AuthorizationToken, error) {
+	return Default().GetAuthorizationTokenDataForSSOUserId(ctx, ssoUserId, partnerID)
+}
+
+// GetAuthorizationTokenDataForSSOUserId fetches partner, role, and advertiser mappings via SpiceDB
+func (a *Authorizer) GetAuthorizationTokenDataForSSOUserId(
+	ctx context.Context, ssoUserId int64, partnerID *int64,
+) (*AuthorizationToken, error) {
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+
+	a.debugf("Generating authz token for SSO user: %d partnerID filter: %v", ssoUserId, partnerID)
 	userType, userID := "users", fmt.Sprintf("%d", ssoUserId)
 
 	// 1. Lookup partners accessible to the user
-	partnerRoot := ListResourceHierarchy("partner", "view", userType, userID)
+	partnerRoot, err := a.ListResourceHierarchy(ctx, "partner", "view", userType, userID)
+	if err != nil {
+		return nil, err
+	}
 	partners := collectIDs(partnerRoot)
-	fmt.Println("Accessible partners for user:", partners)
+	a.debugf("Accessible partners for user: %v", partners)
 	if len(partners) == 0 {
 		return nil, fmt.Errorf("no partners found for user %d", ssoUserId)
 	}
@@ -61,12 +81,15 @@ func GetAuthorizationTokenDataForSSOUserId(
 			return nil, fmt.Errorf("user %d has no role under partner %d", ssoUserId, *partnerID)
 		}
 	} else {
-		fmt.Println("No partnerID filter provided; defaulting to first partner:", partners[0])
+		a.debugf("No partnerID filter provided; defaulting to first partner: %s", partners[0])
 		selectedPartner = partners[0]
 	}
 
 	// 3. Lookup roles for this user under the selected partner
-	roleRoot := ListResourceHierarchy("roles", "user", userType, userID) // in future can be handled for multiple roles for that same user
+	roleRoot, err := a.ListResourceHierarchy(ctx, "roles", "user", userType, userID) // in future can be handled for multiple roles for that same user
+	if err != nil {
+		return nil, err
+	}
 	roles := collectIDs(roleRoot)
 	if len(roles) == 0 {
 		return nil, fmt.Errorf("no role found for user %d under %s", ssoUserId, selectedPartner)
@@ -74,7 +97,10 @@ func GetAuthorizationTokenDataForSSOUserId(
 	roleID := strings.TrimPrefix(roles[0], "roles:")
 
 	// 4. Lookup advertisers visible to this user
-	advertiserRoot := ListResourceHierarchy("advertiser", "view", userType, userID)
+	advertiserRoot, err := a.ListResourceHierarchy(ctx, "advertiser", "view", userType, userID)
+	if err != nil {
+		return nil, err
+	}
 	advertisers := collectIDs(advertiserRoot)
 
 	var advertiserIDs []int64
@@ -2,354 +2,468 @@ package authz
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
 )
 
-// Convert JSON → SpiceDB relation strings
-func Translate(jsonData map[string]interface{}) []string {
-	var rels []string
-
-	// --- Roles ---
-	if roles, ok := jsonData["roles"].(map[string]interface{}); ok {
-		fmt.Println("Processing roles...", roles)
-		for role, v := range roles {
-			fmt.Println("Processing role:", role, v)
-			if roleMap, ok := v.(map[string]interface{}); ok {
-				for a, user := range toStrSlice(roleMap["users"]) {
-					fmt.Println("users:", user, a)
-					fmt.Println("Adding role user:", role, user)
-					rels = append(rels, fmt.Sprintf("roles:%s#user@users:%s", role, user))
-				}
-				for _, scope := range toStrSlice(roleMap["scopes"]) {
-					// scope must be one of: partner:ID | advertiser:ID | publisher:ID | feature:ID
-					if subj, ok := parseScopedSubject(scope, []string{"partner", "advertiser", "publisher", "feature", "page"}); ok {
-						rels = append(rels, fmt.Sprintf("roles:%s#scope@%s", role, subj))
-					}
-				}
-			}
-		}
+// TranslatedRelationship is a relationship produced by Translate together
+// with the config path it came from, e.g. "partners.Dentsu.users".
+type TranslatedRelationship struct {
+	Relationship Relationship `json:"relationship"`
+	Path         string       `json:"path"`
+}
+
+// translation collects relationships in order. A tuple produced twice keeps
+// its first path (and caveat): SpiceDB takes one update per tuple.
+type translation struct {
+	out  []TranslatedRelationship
+	seen map[string]bool
+	// objects maps every "type:id" the config defines, with or without
+	// relationships, to its path.
+	objects map[string]string
+}
+
+func (t *translation) add(path string, r Relationship) {
+	k := r.Key()
+	if t.seen[k] {
+		return
 	}
+	t.seen[k] = true
+	t.out = append(t.out, TranslatedRelationship{Relationship: r, Path: path})
+}
 
-	// --- Superroot ---
-	if sr, ok := jsonData["superroot"].(map[string]interface{}); ok {
-		for root, cfg := range sr {
-			if cfgMap, ok := cfg.(map[string]interface{}); ok {
-				for _, sa := range toStrSlice(cfgMap["superadmin"]) {
-					rels = append(rels, fmt.Sprintf("superroot:%s#superadmin@users:%s", root, sa))
-				}
-				for _, sa := range toStrSlice(cfgMap["globaluser"]) {
-					rels = append(rels, fmt.Sprintf("superroot:%s#globaluser@globaluser:%s", root, sa))
-				}
-			}
+// rel builds resType:resID#relation@subType:subID.
+func rel(resType, resID, relation, subType, subID string) Relationship {
+	return Relationship{ResourceType: resType, ResourceID: resID, Relation: relation, SubjectType: subType, SubjectID: subID}
+}
+
+// Translator maps config documents to relationships by reading a schema
+// instead of hardcoding it. Every definition with relations is a config
+// section named in the plural ("partners" for partner), and every relation
+// is a key of that section's objects, also in the plural ("users" for user,
+// "denied_users" for denied_user). The singular spellings are accepted too.
+//
+// A value is checked against the subject types the relation admits:
+//
+//	"alice"                      an id, when the relation admits one plain subject type
+//	"partner:P1", "roles:r#user" a subject, when it admits several
+//	true, "*"                    the wildcard, e.g. for public: users:*
+//	{"user": "alice", "caveat": "within_window", "context": {...}, "expiration": "2030-01-02T15:04:05Z"}
+//
+// A definition whose parent relation admits its own type may nest objects
+// under "children"; each child gets the enclosing object as its parent.
+type Translator struct {
+	schema   *Schema
+	sections map[string]string // section key, either spelling → definition
+	maxDepth int
+}
+
+// singularSections and singularKeys are spelled in the singular by existing
+// configs; Export keeps that spelling.
+var (
+	singularSections = map[string]bool{"superroot": true}
+	singularKeys     = map[string]bool{"root": true, "parent": true, "superadmin": true}
+)
+
+// NewTranslator builds a Translator for s.
+func NewTranslator(s *Schema) *Translator {
+	t := &Translator{schema: s, sections: map[string]string{}, maxDepth: DefaultMaxDepth}
+	for _, name := range s.DefinitionOrder {
+		if len(s.Definitions[name].RelationOrder) > 0 {
+			t.sections[name] = name
+			t.sections[sectionName(name)] = name
 		}
 	}
+	return t
+}
 
-	if sr, ok := jsonData["globaluser"].(map[string]interface{}); ok {
-		for root, cfg := range sr {
-			if cfgMap, ok := cfg.(map[string]interface{}); ok {
-				for _, sa := range toStrSlice(cfgMap["globaladmin"]) {
-					rels = append(rels, fmt.Sprintf("globaluser:%s#globaladmin@users:%s", root, sa))
-				}
-			}
-		}
+var defaultTranslator = sync.OnceValue(func() *Translator {
+	s, err := ParseSchema(schema.Zed)
+	if err != nil {
+		panic("authz: embedded schema: " + err.Error())
 	}
+	return NewTranslator(s)
+})
 
-	// --- APIs ---
-	if apis, ok := jsonData["apis"].(map[string]interface{}); ok {
-		for aname, v := range apis {
-			if aMap, ok := v.(map[string]interface{}); ok {
-				// parent → must be a feature
-				if parent := getString(aMap["parent"]); parent != "" {
-					if subj, ok := parseScopedSubject(parent, []string{"feature"}); ok {
-						rels = append(rels, fmt.Sprintf("api:%s#parent@%s", aname, subj))
-					}
-				}
-				// roles
-				for _, r := range toStrSlice(aMap["roles"]) {
-					rels = append(rels, fmt.Sprintf("api:%s#role@roles:%s", aname, r))
-				}
-				// users
-				for _, u := range toStrSlice(aMap["users"]) {
-					rels = append(rels, fmt.Sprintf("api:%s#user@users:%s", aname, u))
-				}
-				// denied users
-				for _, d := range toStrSlice(aMap["denied_users"]) {
-					rels = append(rels, fmt.Sprintf("api:%s#denied_user@users:%s", aname, d))
-				}
-			}
+// WithMaxDepth returns a copy of t that allows parent chains of up to n
+// objects instead of DefaultMaxDepth; zero or less only rejects cycles.
+func (t *Translator) WithMaxDepth(n int) *Translator {
+	c := *t
+	c.maxDepth = n
+	return &c
+}
+
+// DefaultTranslator translates against the embedded schema.zed.
+func DefaultTranslator() *Translator {
+	return defaultTranslator()
+}
+
+// ResourceTypes lists the definitions a config can write relationships on,
+// i.e. the types a config owns when it is reconciled.
+func (t *Translator) ResourceTypes() []string {
+	var types []string
+	for _, name := range t.schema.DefinitionOrder {
+		if t.sections[name] != "" {
+			types = append(types, name)
 		}
 	}
+	return types
+}
 
-	// --- Pages ---
-	if pages, ok := jsonData["pages"].(map[string]interface{}); ok {
-		for pname, v := range pages {
-			if pMap, ok := v.(map[string]interface{}); ok {
-				// root → superroot
-				if root := getString(pMap["root"]); root != "" {
-					rels = append(rels, fmt.Sprintf("page:%s#root@superroot:%s", pname, root))
-				}
-				// users
-				for _, u := range toStrSlice(pMap["users"]) {
-					rels = append(rels, fmt.Sprintf("page:%s#user@users:%s", pname, u))
-				}
-				// roles
-				for _, r := range toStrSlice(pMap["roles"]) {
-					rels = append(rels, fmt.Sprintf("page:%s#role@roles:%s", pname, r))
-				}
-				// public
-				if hasWildcard(pMap["public"]) {
-					rels = append(rels, fmt.Sprintf("page:%s#public@users:*", pname))
-				}
-				// denied
-				for _, d := range toStrSlice(pMap["denied_users"]) {
-					rels = append(rels, fmt.Sprintf("page:%s#denied_user@users:%s", pname, d))
-				}
-				// features attached directly to page
-				for _, f := range toStrSlice(pMap["features"]) {
-					if subj, ok := parseScopedSubject(f, []string{"feature"}); ok {
-						rels = append(rels, fmt.Sprintf("page:%s#feature@%s", pname, subj))
-					}
-				}
-			}
-		}
+// Translate converts a config document into SpiceDB relationship strings.
+// It is DecodeConfig followed by Config.Translate: nothing that fails to fit
+// the schema is skipped, it is returned in a *ConfigError instead.
+func Translate(jsonData map[string]interface{}) ([]string, error) {
+	translated, err := TranslateWithPaths(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	rels := make([]string, len(translated))
+	for i, tr := range translated {
+		rels[i] = tr.Relationship.String()
 	}
+	return rels, nil
+}
 
-	// --- Partners ---
-	// --- Partners ---
-	if partners, ok := jsonData["partners"].(map[string]interface{}); ok {
-		for pname, v := range partners {
-			if pMap, ok := v.(map[string]interface{}); ok {
-				// root → superroot
-				if root := getString(pMap["root"]); root != "" {
-					rels = append(rels, fmt.Sprintf("partner:%s#root@superroot:%s", pname, root))
-				}
-				// users
-				for _, u := range toStrSlice(pMap["users"]) {
-					rels = append(rels, fmt.Sprintf("partner:%s#user@users:%s", pname, u))
-				}
-				// roles
-				for _, r := range toStrSlice(pMap["roles"]) {
-					rels = append(rels, fmt.Sprintf("partner:%s#role@roles:%s", pname, r))
-				}
-				// public wildcard
-				if hasWildcard(pMap["public"]) {
-					rels = append(rels, fmt.Sprintf("partner:%s#public@users:*", pname))
-				}
-				// 🔥 NEW: global wildcard
-				if hasWildcard(pMap["global"]) {
-					rels = append(rels, fmt.Sprintf("partner:%s#global@globaluser:*", pname))
-				}
-				// denied users
-				for _, d := range toStrSlice(pMap["denied_users"]) {
-					rels = append(rels, fmt.Sprintf("partner:%s#denied_user@users:%s", pname, d))
-				}
-			}
-		}
+// TranslateWithPaths is Translate, but reports where in the config each
+// relationship came from so problems can point back at it.
+func TranslateWithPaths(jsonData map[string]interface{}) ([]TranslatedRelationship, error) {
+	c, err := DecodeConfig(jsonData)
+	if err != nil {
+		return nil, err
 	}
+	return c.Translate()
+}
 
-	// --- Advertisers ---
-	if advs, ok := jsonData["advertisers"].(map[string]interface{}); ok {
-		for aname, v := range advs {
-			if aMap, ok := v.(map[string]interface{}); ok {
-				// root → superroot
-				if root := getString(aMap["root"]); root != "" {
-					rels = append(rels, fmt.Sprintf("advertiser:%s#root@superroot:%s", aname, root))
-				}
-				// parent partner
-				if parent := getString(aMap["parent"]); parent != "" {
-					if subj, ok := parseScopedSubject(parent, []string{"partner"}); ok {
-						rels = append(rels, fmt.Sprintf("advertiser:%s#parent@%s", aname, subj))
-					}
-				}
-				// users / roles
-				for _, r := range toStrSlice(aMap["roles"]) {
-					rels = append(rels, fmt.Sprintf("advertiser:%s#role@roles:%s", aname, r))
-				}
-				for _, u := range toStrSlice(aMap["users"]) {
-					rels = append(rels, fmt.Sprintf("advertiser:%s#user@users:%s", aname, u))
-				}
-				// public / denied
-				if hasWildcard(aMap["public"]) {
-					rels = append(rels, fmt.Sprintf("advertiser:%s#public@users:*", aname))
-				}
-				for _, d := range toStrSlice(aMap["denied_users"]) {
-					rels = append(rels, fmt.Sprintf("advertiser:%s#denied_user@users:%s", aname, d))
-				}
+// Translate turns a config document into relationships, each with the config
+// path it came from. Unknown sections or keys, values the schema does not
+// admit, and parent cycles or chains deeper than the limit (see WithMaxDepth)
+// are returned together in a *ConfigError.
+//
+// The order is stable: sections in schema order, objects by id, keys in
+// relation order, and an object's children right after the object itself.
+func (t *Translator) Translate(doc map[string]interface{}) ([]TranslatedRelationship, error) {
+	out, problems := t.translate(doc)
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return out, nil
+}
+
+func (t *Translator) translate(doc map[string]interface{}) ([]TranslatedRelationship, []ConfigProblem) {
+	tr, problems := t.walk(doc)
+	return tr.out, problems
+}
+
+// walk translates doc, keeping track of the objects it defines.
+func (t *Translator) walk(doc map[string]interface{}) (*translation, []ConfigProblem) {
+	d := &configDecoder{}
+	tr := &translation{seen: map[string]bool{}, objects: map[string]string{}}
+	for _, key := range sortedObjectKeys(doc) {
+		if t.sections[key] == "" {
+			d.problemf(key, "unknown section (want one of %s)", strings.Join(t.sectionNames(), ", "))
+		}
+	}
+	for _, def := range t.ResourceTypes() {
+		for _, key := range sortedObjectKeys(doc) {
+			if t.sections[key] != def {
+				continue
+			}
+			objects, ok := d.object(key, doc[key])
+			if !ok {
+				continue
+			}
+			for _, id := range sortedObjectKeys(objects) {
+				t.object(tr, d, key+"."+id, def, id, objects[id], "")
 			}
 		}
 	}
+	hierarchyProblems(tr, d, t.maxDepth)
+	return tr, d.problems
+}
 
-	// --- Publishers ---
-	if pubs, ok := jsonData["publishers"].(map[string]interface{}); ok {
-		for pname, v := range pubs {
-			if pMap, ok := v.(map[string]interface{}); ok {
-				// root → superroot
-				if root := getString(pMap["root"]); root != "" {
-					rels = append(rels, fmt.Sprintf("publisher:%s#root@superroot:%s", pname, root))
-				}
-				// parent partner
-				if parent := getString(pMap["parent"]); parent != "" {
-					if subj, ok := parseScopedSubject(parent, []string{"partner"}); ok {
-						rels = append(rels, fmt.Sprintf("publisher:%s#parent@%s", pname, subj))
-					}
-				}
-				// users / roles
-				for _, r := range toStrSlice(pMap["roles"]) {
-					rels = append(rels, fmt.Sprintf("publisher:%s#role@roles:%s", pname, r))
-				}
-				for _, u := range toStrSlice(pMap["users"]) {
-					rels = append(rels, fmt.Sprintf("publisher:%s#user@users:%s", pname, u))
-				}
-				// public / denied
-				if hasWildcard(pMap["public"]) {
-					rels = append(rels, fmt.Sprintf("publisher:%s#public@users:*", pname))
-				}
-				for _, d := range toStrSlice(pMap["denied_users"]) {
-					rels = append(rels, fmt.Sprintf("publisher:%s#denied_user@users:%s", pname, d))
-				}
+// object translates def:id and, recursively, its children.
+func (t *Translator) object(tr *translation, d *configDecoder, path, def, id string, in interface{}, parent string) {
+	obj, ok := d.object(path, in)
+	if !ok {
+		return
+	}
+	defn := t.schema.Definitions[def]
+	if _, dup := tr.objects[def+":"+id]; !dup {
+		tr.objects[def+":"+id] = path
+	}
+	if parent != "" {
+		tr.add(path, rel(def, id, "parent", def, parent))
+	}
+
+	byRelation := map[string][]string{}
+	for _, key := range sortedObjectKeys(obj) {
+		if key == "children" && t.nests(def) {
+			continue
+		}
+		r := t.relationForKey(defn, key)
+		if r == nil {
+			d.problemf(join(path, key), "unknown field (want one of %s)", strings.Join(t.keyNames(defn), ", "))
+			continue
+		}
+		byRelation[r.Name] = append(byRelation[r.Name], key)
+	}
+	for _, rn := range defn.RelationOrder {
+		for _, key := range byRelation[rn] {
+			for _, r := range t.subjects(d, join(path, key), defn.Relations[rn], obj[key]) {
+				r.ResourceType, r.ResourceID, r.Relation = def, id, rn
+				tr.add(join(path, key), r)
 			}
 		}
 	}
 
-	// --- Features (recursive + top-level parent/root) ---
-	if features, ok := jsonData["features"].(map[string]interface{}); ok {
-		for fname, v := range features {
-			rels = append(rels, processFeature(fname, v, "")...)
+	if children, ok := obj["children"]; ok && t.nests(def) {
+		if kids, ok := d.object(join(path, "children"), children); ok {
+			for _, cid := range sortedObjectKeys(kids) {
+				t.object(tr, d, path+".children."+cid, def, cid, kids[cid], id)
+			}
 		}
 	}
-
-	return dedupStrings(flatten(rels))
 }
 
-// Recursive feature processing
-func processFeature(fname string, raw interface{}, parentFeature string) []string {
-	var rels []string
-	fmap, ok := raw.(map[string]interface{})
-	if !ok {
-		return rels
+// subjects decodes a config value into the subjects it names. Only the
+// subject, caveat and expiration of the results are set.
+func (t *Translator) subjects(d *configDecoder, path string, r *RelationDef, in interface{}) []Relationship {
+	var items []interface{}
+	_, isList := in.([]interface{})
+	switch v := in.(type) {
+	case nil:
+		return nil
+	case bool:
+		if !v {
+			return nil
+		}
+		items = []interface{}{"*"}
+	case []interface{}:
+		items = v
+	default:
+		items = []interface{}{v}
 	}
 
-	// If nested under another feature, set parent to that feature
-	if parentFeature != "" {
-		rels = append(rels, fmt.Sprintf("feature:%s#parent@feature:%s", fname, parentFeature))
+	var out []Relationship
+	for i, e := range items {
+		p := path
+		if isList {
+			p = fmt.Sprintf("%s[%d]", path, i)
+		}
+		var s Relationship
+		var ok bool
+		switch v := e.(type) {
+		case string:
+			s, ok = t.subject(d, p, r, v)
+		case map[string]interface{}:
+			s, ok = t.grant(d, p, r, v)
+		default:
+			d.problemf(p, "expected a subject or a {user, caveat, context, expiration} object, got %s", describe(e))
+		}
+		if ok {
+			out = append(out, s)
+		}
 	}
+	return out
+}
 
-	// Optional explicit root for feature → superroot
-	if root := getString(fmap["root"]); root != "" {
-		rels = append(rels, fmt.Sprintf("feature:%s#root@superroot:%s", fname, root))
+// subject resolves "id", "type:id", "type:id#relation", "type:*" or "*"
+// against the subject types r admits.
+func (t *Translator) subject(d *configDecoder, path string, r *RelationDef, text string) (Relationship, bool) {
+	var s Relationship
+	switch typ, rest, typed := strings.Cut(text, ":"); {
+	case text == "":
+		d.problemf(path, "empty value")
+		return s, false
+	case typed:
+		s.SubjectType = typ
+		s.SubjectID, s.SubjectRelation, _ = strings.Cut(rest, "#")
+	default:
+		types := plainTypes(r, text == "*")
+		if len(types) != 1 {
+			d.problemf(path, "%q is ambiguous or not allowed: write TYPE:ID, %s admits %s", text, r.Name, relationTypes(r))
+			return s, false
+		}
+		s.SubjectType, s.SubjectID = types[0], text
+	}
+	if s.SubjectID == "" {
+		d.problemf(path, "%q has no id", text)
+		return s, false
 	}
+	return s, t.admits(d, path, r, s)
+}
 
-	// Optional explicit top-level parent for feature (advertiser|publisher|feature)
-	// Accepts string or []string; each value like "advertiser:adv1", "publisher:pub1", or "feature:parent"
-	for _, p := range toStrSlice(fmap["parent"]) {
-		if subj, ok := parseScopedSubject(p, []string{"advertiser", "publisher", "feature", "partner", "page"}); ok {
-			rels = append(rels, fmt.Sprintf("feature:%s#parent@%s", fname, subj))
+// grant reads {"user": ..., "caveat": ..., "context": {...}, "expiration": ...};
+// "subject" may stand in for "user" when the subject is not a user.
+func (t *Translator) grant(d *configDecoder, path string, r *RelationDef, obj map[string]interface{}) (Relationship, bool) {
+	var who string
+	var s Relationship
+	ok := true
+	for _, k := range sortedObjectKeys(obj) {
+		v := obj[k]
+		good := true
+		switch k {
+		case "user", "subject":
+			who, good = v.(string)
+		case "caveat":
+			s.Caveat, good = v.(string)
+		case "context":
+			s.CaveatContext, good = v.(map[string]interface{})
+		case "expiration":
+			var text string
+			if text, good = v.(string); good {
+				exp, err := time.Parse(time.RFC3339, text)
+				if err != nil {
+					d.problemf(join(path, k), "want an RFC 3339 time: %v", err)
+					ok = false
+				}
+				s.Expiration = exp
+			}
+		default:
+			d.problemf(join(path, k), "unknown field (want one of user, caveat, context, expiration)")
+			ok = false
+			continue
+		}
+		if !good {
+			d.problemf(join(path, k), "unexpected %s", describe(v))
+			ok = false
 		}
 	}
-
-	// users / roles
-	for _, u := range toStrSlice(fmap["users"]) {
-		rels = append(rels, fmt.Sprintf("feature:%s#user@users:%s", fname, u))
+	if who == "" {
+		d.problemf(path, "missing user")
+		return s, false
 	}
-	for _, r := range toStrSlice(fmap["roles"]) {
-		rels = append(rels, fmt.Sprintf("feature:%s#role@roles:%s", fname, r))
+	if s.CaveatContext != nil && s.Caveat == "" {
+		d.problemf(join(path, "context"), "context without a caveat")
+		ok = false
 	}
-
-	// public / denied
-	if hasWildcard(fmap["public"]) {
-		rels = append(rels, fmt.Sprintf("feature:%s#public@users:*", fname))
+	if !ok {
+		return s, false
 	}
-	for _, d := range toStrSlice(fmap["denied_users"]) {
-		rels = append(rels, fmt.Sprintf("feature:%s#denied_user@users:%s", fname, d))
+	subject, ok := t.subject(d, path, r, who)
+	if !ok {
+		return s, false
 	}
+	subject.Caveat, subject.CaveatContext, subject.Expiration = s.Caveat, s.CaveatContext, s.Expiration
+	return subject, t.admits(d, path, r, subject)
+}
 
-	// children
-	if children, ok := fmap["children"].(map[string]interface{}); ok {
-		for cname, cv := range children {
-			rels = append(rels, processFeature(cname, cv, fname)...)
+// admits reports whether r allows the subject, caveat and expiration of s,
+// recording a problem if not.
+func (t *Translator) admits(d *configDecoder, path string, r *RelationDef, s Relationship) bool {
+	want := SubjectType{Type: s.SubjectType, Relation: s.SubjectRelation, Wildcard: s.SubjectID == "*",
+		Caveat: s.Caveat, Expiration: !s.Expiration.IsZero()}
+	for _, st := range r.Types {
+		if st == want {
+			return true
 		}
 	}
-
-	return rels
+	d.problemf(path, "%s is not allowed on %s (want %s)", want, r.Name, relationTypes(r))
+	return false
 }
 
-// ----------------- helpers -----------------
+// plainTypes lists the distinct subject types r admits without a subject
+// relation: the wildcard ones or the others.
+func plainTypes(r *RelationDef, wildcard bool) []string {
+	var types []string
+	for _, st := range r.Types {
+		if st.Relation == "" && st.Wildcard == wildcard && !contains(types, st.Type) {
+			types = append(types, st.Type)
+		}
+	}
+	return types
+}
 
-func toStrSlice(v interface{}) []string {
-	var out []string
-	switch t := v.(type) {
-	case string:
-		if t != "" {
-			out = append(out, t)
+// onlyWildcards reports whether r holds nothing but a wildcard, like
+// "public: users:*". Such keys read as flags.
+func onlyWildcards(r *RelationDef) bool {
+	for _, st := range r.Types {
+		if !st.Wildcard {
+			return false
 		}
-	case []interface{}:
-		for _, e := range t {
-			if s, ok := e.(string); ok && s != "" {
-				out = append(out, s)
-			}
+	}
+	return len(r.Types) > 0
+}
+
+// nests reports whether objects of def may have children: its parent
+// relation admits def itself.
+func (t *Translator) nests(def string) bool {
+	r := t.schema.Relation(def, "parent")
+	return r != nil && contains(plainTypes(r, false), def)
+}
+
+func (t *Translator) relationForKey(defn *Definition, key string) *RelationDef {
+	if r := defn.Relations[key]; r != nil {
+		return r
+	}
+	for _, rn := range defn.RelationOrder {
+		if plural(rn) == key {
+			return defn.Relations[rn]
 		}
 	}
-	return out
+	return nil
 }
 
-func getString(v interface{}) string {
-	if s, ok := v.(string); ok {
-		return s
+// keyName is the spelling Export uses for a relation.
+func keyName(r *RelationDef) string {
+	if singularKeys[r.Name] || onlyWildcards(r) {
+		return r.Name
 	}
-	return ""
+	return plural(r.Name)
 }
 
-// hasWildcard interprets public flags as: true | "*" | ["*"]
-func hasWildcard(v interface{}) bool {
-	switch t := v.(type) {
-	case bool:
-		return t
-	case string:
-		return t == "*"
-	case []interface{}:
-		for _, e := range t {
-			if s, ok := e.(string); ok && s == "*" {
-				return true
-			}
-		}
+func (t *Translator) keyNames(defn *Definition) []string {
+	var names []string
+	for _, rn := range defn.RelationOrder {
+		names = append(names, keyName(defn.Relations[rn]))
 	}
-	return false
+	if t.nests(defn.Name) {
+		names = append(names, "children")
+	}
+	return names
 }
 
-// parseScopedSubject ensures the subject has an allowed type prefix.
-func parseScopedSubject(s string, allowed []string) (string, bool) {
-	parts := strings.SplitN(s, ":", 2)
-	if len(parts) != 2 {
-		return "", false
+func sectionName(def string) string {
+	if singularSections[def] {
+		return def
 	}
-	typ, id := parts[0], parts[1]
-	for _, a := range allowed {
-		if typ == a && id != "" {
-			return fmt.Sprintf("%s:%s", typ, id), true
-		}
+	return plural(def)
+}
+
+func (t *Translator) sectionNames() []string {
+	var names []string
+	for _, def := range t.ResourceTypes() {
+		names = append(names, sectionName(def))
 	}
-	return "", false
+	return names
 }
 
-func dedupStrings(in []string) []string {
-	seen := make(map[string]struct{}, len(in))
-	out := make([]string, 0, len(in))
-	for _, s := range in {
-		if _, ok := seen[s]; ok {
-			continue
-		}
-		seen[s] = struct{}{}
-		out = append(out, s)
+func plural(s string) string {
+	if strings.HasSuffix(s, "s") {
+		return s
 	}
-	return out
+	return s + "s"
 }
 
-func flatten(in []string) []string {
-	out := make([]string, 0, len(in))
-	for _, v := range in {
-		if v != "" {
-			out = append(out, v)
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
 		}
 	}
-	return out
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,149 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TreeLevel is one resource type in a ListResourceTree and the permission
+// the subject needs for an object of that type to be shown.
+type TreeLevel struct {
+	Type       string `json:"type"`
+	Permission string `json:"permission"`
+}
+
+// DefaultTreeLevels is the tree the UI shows: partners, the advertisers and
+// publishers under them, their features (nested) and the APIs under those.
+var DefaultTreeLevels = []TreeLevel{
+	{Type: "partner", Permission: "view"},
+	{Type: "advertiser", Permission: "view"},
+	{Type: "publisher", Permission: "view"},
+	{Type: "feature", Permission: "view"},
+	{Type: "api", Permission: "call"},
+}
+
+// ParseTreeLevels parses "partner:view,advertiser:view,...".
+func ParseTreeLevels(s string) ([]TreeLevel, error) {
+	var levels []TreeLevel
+	for _, part := range strings.Split(s, ",") {
+		typ, perm, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || typ == "" || perm == "" {
+			return nil, &Error{Op: "parse tree levels", Kind: ErrInvalidArgument, Err: fmt.Errorf("%q is not TYPE:PERMISSION", part)}
+		}
+		levels = append(levels, TreeLevel{Type: typ, Permission: perm})
+	}
+	return levels, nil
+}
+
+func ListResourceTree(subjectType, subjectID string, levels []TreeLevel, annotate ...string) (*Node, error) {
+	return ListResourceTreeContext(Context(), subjectType, subjectID, levels, annotate...)
+}
+
+func ListResourceTreeContext(ctx context.Context, subjectType, subjectID string, levels []TreeLevel, annotate ...string) (*Node, error) {
+	return Default().ListResourceTree(ctx, subjectType, subjectID, levels, annotate...)
+}
+
+// ListResourceTree returns, in one tree, every object of the given levels
+// the subject holds that level's permission on, each nested under the
+// visible objects it names as parent whatever their type. An object whose
+// parents are all hidden becomes a top-level node; one with several visible
+// parents appears under each. Siblings are ordered by level, then id. Nil
+// levels means DefaultTreeLevels. Permissions in annotate are checked on
+// every node whose type defines them (see Node.Permissions).
+func (a *Authorizer) ListResourceTree(ctx context.Context, subjectType, subjectID string, levels []TreeLevel, annotate ...string) (*Node, error) {
+	ctx, cancel := a.callContext(ctx)
+	defer cancel()
+	if levels == nil {
+		levels = DefaultTreeLevels
+	}
+
+	// 1. What the subject can see on each level, looked up in parallel.
+	ids := make([][]string, len(levels))
+	errs := make([]error, len(levels))
+	var wg sync.WaitGroup
+	for i, l := range levels {
+		wg.Add(1)
+		go func(i int, l TreeLevel) {
+			defer wg.Done()
+			ids[i], errs[i] = a.LookupResources(ctx, l.Type, l.Permission, subjectType, subjectID)
+		}(i, l)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rank := map[string]int{}
+	nodes := map[string]*Node{}
+	var objects []string
+	for i, l := range levels {
+		if _, dup := rank[l.Type]; !dup {
+			rank[l.Type] = i
+		}
+		for _, id := range ids[i] {
+			key := l.Type + ":" + id
+			if nodes[key] == nil {
+				nodes[key] = &Node{Type: l.Type, ID: id}
+				objects = append(objects, key)
+			}
+		}
+	}
+	a.debugf("Tree: %d visible objects on %d levels", len(objects), len(levels))
+
+	// 2. Their parents, keeping only edges between visible objects.
+	s, err := a.liveSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	parents, err := a.readParents(ctx, s, objects, "")
+	if err != nil {
+		return nil, err
+	}
+	var edges []Relationship
+	for _, child := range objects {
+		for _, p := range parents[child] {
+			if nodes[p] != nil {
+				ct, cid, _ := strings.Cut(child, ":")
+				pt, pid, _ := strings.Cut(p, ":")
+				edges = append(edges, rel(ct, cid, "parent", pt, pid))
+			}
+		}
+	}
+	if herr := findHierarchyIssues(edges, 0); herr != nil {
+		return nil, &Error{Op: "list resource tree", Err: herr}
+	}
+
+	// 3. Link and order.
+	less := func(x, y *Node) bool {
+		if rank[x.Type] != rank[y.Type] {
+			return rank[x.Type] < rank[y.Type]
+		}
+		return x.ID < y.ID
+	}
+	hasParent := map[string]bool{}
+	for _, e := range edges {
+		child := nodes[e.ResourceType+":"+e.ResourceID]
+		parent := nodes[e.Subject()]
+		parent.Children = append(parent.Children, child)
+		hasParent[e.ResourceType+":"+e.ResourceID] = true
+	}
+	var roots, ordered []*Node
+	for _, key := range objects {
+		n := nodes[key]
+		ordered = append(ordered, n)
+		sort.Slice(n.Children, func(i, j int) bool { return less(n.Children[i], n.Children[j]) })
+		if !hasParent[key] {
+			roots = append(roots, n)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return less(roots[i], roots[j]) })
+	if err := a.annotate(ctx, subjectType, subjectID, ordered, annotate); err != nil {
+		return nil, err
+	}
+	return &Node{ID: "root", Type: "root", Children: roots}, nil
+}
@@ -0,0 +1,86 @@
+package authz
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
+)
+
+// treeTestRels give users:u one chain partner → advertiser → feature → api,
+// a feature whose parent is hidden, and objects u cannot see.
+var treeTestRels = []string{
+	"partner:p#user@users:u",
+	"advertiser:a#parent@partner:p",
+	"advertiser:hidden#parent@partner:q",
+	"feature:f#parent@advertiser:a",
+	"feature:f#user@users:u",
+	"feature:g#parent@advertiser:hidden",
+	"feature:g#public@users:*",
+	"feature:f2#parent@advertiser:a",
+	"api:x#parent@feature:f",
+	"api:y#parent@feature:f2",
+}
+
+// renderTree writes n as "type:id[perm=result ...]{children}".
+func renderTree(n *Node) string {
+	var b strings.Builder
+	b.WriteString(n.Type + ":" + n.ID)
+	if len(n.Permissions) > 0 {
+		var perms []string
+		for p, r := range n.Permissions {
+			perms = append(perms, p+"="+r.String())
+		}
+		sort.Strings(perms)
+		b.WriteString("[" + strings.Join(perms, " ") + "]")
+	}
+	if len(n.Children) > 0 {
+		children := make([]string, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = renderTree(c)
+		}
+		b.WriteString("{" + strings.Join(children, " ") + "}")
+	}
+	return b.String()
+}
+
+func TestListResourceTree(t *testing.T) {
+	a := NewAuthorizer(newSchemaClient(t, schema.Zed, treeTestRels...))
+	tree, err := a.ListResourceTree(context.Background(), "users", "u", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Partners sort before features at the top; g's parent is hidden, and
+	// f2 (no user) and so y are not visible.
+	want := "root:root{partner:p{advertiser:a{feature:f{api:x}}} feature:g}"
+	if got := renderTree(tree); got != want {
+		t.Errorf("tree =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestListResourceTreeAnnotations(t *testing.T) {
+	rels := append([]string{"superroot:r#superadmin@users:u", "feature:f#root@superroot:r"}, treeTestRels...)
+	hook := &bulkHook{MemoryClient: newSchemaClient(t, schema.Zed, rels...)}
+	a := NewAuthorizer(hook)
+	tree, err := a.ListResourceTree(context.Background(), "users", "u", nil, "view", "admin", "call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each node carries only the permissions its type defines; admin on
+	// feature:f comes down to the api under it.
+	want := "root:root{" +
+		"partner:p[admin=denied view=granted]{" +
+		"advertiser:a[admin=denied view=granted]{" +
+		"feature:f[admin=granted view=granted]{" +
+		"api:x[admin=granted call=granted]}}} " +
+		"feature:g[admin=denied view=granted]}"
+	if got := renderTree(tree); got != want {
+		t.Errorf("tree =\n%s\nwant\n%s", got, want)
+	}
+	// Every annotation of the five nodes, in one bulk request.
+	if want := []int{15}; !equalInts(hook.sizes, want) {
+		t.Errorf("bulk check requests = %v, want %v", hook.sizes, want)
+	}
+}
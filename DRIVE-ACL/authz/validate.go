@@ -0,0 +1,73 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/status"
+)
+
+// RelationshipProblem is a translated relationship the schema rejects.
+type RelationshipProblem struct {
+	Path         string `json:"path"`
+	Relationship string `json:"relationship"`
+	Reason       string `json:"reason"`
+}
+
+func (p RelationshipProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Path, p.Relationship, p.Reason)
+}
+
+// ValidationError reports every relationship in a payload that does not fit
+// the schema. It matches ErrSchemaMismatch with errors.Is.
+type ValidationError struct {
+	Problems []RelationshipProblem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return fmt.Sprintf("%d relationship(s) do not match the schema:\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrSchemaMismatch
+}
+
+// ValidateTranslation checks each translated relationship against the
+// schema's relations and their allowed subject types, and returns a
+// *ValidationError listing all of the offenders, or nil.
+func (s *Schema) ValidateTranslation(rels []TranslatedRelationship) error {
+	var problems []RelationshipProblem
+	for _, tr := range rels {
+		text := tr.Relationship.String()
+		problem := func(reason string) {
+			problems = append(problems, RelationshipProblem{Path: tr.Path, Relationship: text, Reason: reason})
+		}
+		// Config values end up in ids verbatim; make sure they still parse.
+		if _, err := ParseRelationship(text); err != nil {
+			var se *RelationshipSyntaxError
+			if errors.As(err, &se) {
+				problem(se.Msg)
+			} else {
+				problem(err.Error())
+			}
+			continue
+		}
+		rel, err := tr.Relationship.Proto()
+		if err != nil {
+			problem(err.Error())
+			continue
+		}
+		if err := s.ValidateRelationship(rel); err != nil {
+			problem(status.Convert(err).Message())
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
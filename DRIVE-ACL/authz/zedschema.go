@@ -0,0 +1,655 @@
+package authz
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Schema is a parsed SpiceDB schema (schema.zed).
+type Schema struct {
+	Definitions map[string]*Definition
+	Caveats     map[string]*CaveatDef
+	// DefinitionOrder and CaveatOrder keep source order for stable output.
+	DefinitionOrder []string
+	CaveatOrder     []string
+	// Source is the text the schema was parsed from.
+	Source string
+}
+
+// Definition is a "definition name { ... }" block.
+type Definition struct {
+	Name            string
+	Relations       map[string]*RelationDef
+	Permissions     map[string]*PermissionDef
+	RelationOrder   []string
+	PermissionOrder []string
+}
+
+// RelationDef is "relation name: type | type:* | type#rel | type with caveat".
+type RelationDef struct {
+	Name  string
+	Types []SubjectType
+}
+
+// SubjectType is one allowed subject of a relation.
+type SubjectType struct {
+	Type       string
+	Relation   string // "roles#user" → "user"
+	Wildcard   bool   // "users:*"
+	Caveat     string // "users with within_window"
+	Expiration bool   // "users with expiration"
+}
+
+// PermissionDef is "permission name = expr".
+type PermissionDef struct {
+	Name string
+	Expr PermExpr
+}
+
+// CaveatDef is "caveat name(params) { expression }".
+type CaveatDef struct {
+	Name       string
+	Params     []CaveatParam
+	Expression string
+
+	expr caveatExpr
+}
+
+// CaveatParam is a typed caveat parameter.
+type CaveatParam struct {
+	Name string
+	Type string
+}
+
+// PermExpr is a permission expression node: *RefExpr, *ArrowExpr, *BinaryExpr or *NilExpr.
+type PermExpr interface {
+	String() string
+}
+
+// RefExpr names a relation or permission on the same definition.
+type RefExpr struct{ Name string }
+
+// ArrowExpr walks Relation and evaluates Target on each subject ("parent->view").
+type ArrowExpr struct{ Relation, Target string }
+
+// BinaryExpr combines two expressions with '+' (union), '&' (intersection)
+// or '-' (exclusion).
+type BinaryExpr struct {
+	Op          byte
+	Left, Right PermExpr
+}
+
+// NilExpr is the empty set.
+type NilExpr struct{}
+
+func (e *RefExpr) String() string   { return e.Name }
+func (e *ArrowExpr) String() string { return e.Relation + "->" + e.Target }
+func (e *NilExpr) String() string   { return "nil" }
+
+// String prints the expression with only the parentheses precedence needs.
+func (e *BinaryExpr) String() string {
+	prec := strings.IndexByte("-&+", e.Op) // loosest first, as in permOps
+	side := func(x PermExpr, right bool) string {
+		if b, ok := x.(*BinaryExpr); ok {
+			if p := strings.IndexByte("-&+", b.Op); p < prec || (right && p == prec) {
+				return "(" + b.String() + ")"
+			}
+		}
+		return x.String()
+	}
+	return fmt.Sprintf("%s %c %s", side(e.Left, false), e.Op, side(e.Right, true))
+}
+
+// String formats the subject type the way schema.zed spells it.
+func (t SubjectType) String() string {
+	s := t.Type
+	switch {
+	case t.Wildcard:
+		s += ":*"
+	case t.Relation != "":
+		s += "#" + t.Relation
+	}
+	var with []string
+	if t.Caveat != "" {
+		with = append(with, t.Caveat)
+	}
+	if t.Expiration {
+		with = append(with, "expiration")
+	}
+	if len(with) > 0 {
+		s += " with " + strings.Join(with, " and ")
+	}
+	return s
+}
+
+// Relation returns the named relation of definition typ, or nil.
+func (s *Schema) Relation(typ, name string) *RelationDef {
+	if d := s.Definitions[typ]; d != nil {
+		return d.Relations[name]
+	}
+	return nil
+}
+
+// Permission returns the named permission of definition typ, or nil.
+func (s *Schema) Permission(typ, name string) *PermissionDef {
+	if d := s.Definitions[typ]; d != nil {
+		return d.Permissions[name]
+	}
+	return nil
+}
+
+// LoadSchemaFile reads and parses a schema.zed file.
+func LoadSchemaFile(path string) (*Schema, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read schema: %w", err)
+	}
+	return ParseSchema(string(src))
+}
+
+// SchemaError is a schema syntax error with its position.
+type SchemaError struct {
+	Line, Col int
+	Msg       string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("schema %d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+// ParseSchema parses the subset of the SpiceDB schema language this service
+// uses: definitions, relations (with wildcards, subject relations, caveats
+// and expiration), permissions and caveats.
+func ParseSchema(src string) (*Schema, error) {
+	p := &schemaParser{src: src}
+	p.advance()
+	s := &Schema{
+		Definitions: map[string]*Definition{},
+		Caveats:     map[string]*CaveatDef{},
+		Source:      src,
+	}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.isIdent("definition"):
+			d, err := p.parseDefinition()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := s.Definitions[d.Name]; dup {
+				return nil, p.errorf("duplicate definition %q", d.Name)
+			}
+			s.Definitions[d.Name] = d
+			s.DefinitionOrder = append(s.DefinitionOrder, d.Name)
+		case p.isIdent("caveat"):
+			c, err := p.parseCaveat()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := s.Caveats[c.Name]; dup {
+				return nil, p.errorf("duplicate caveat %q", c.Name)
+			}
+			s.Caveats[c.Name] = c
+			s.CaveatOrder = append(s.CaveatOrder, c.Name)
+		default:
+			return nil, p.errorf("expected definition or caveat, found %s", p.tok)
+		}
+	}
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// check resolves names: every relation type, caveat and permission reference
+// must point at something that exists.
+func (s *Schema) check() error {
+	for _, dn := range s.DefinitionOrder {
+		d := s.Definitions[dn]
+		for _, rn := range d.RelationOrder {
+			for _, t := range d.Relations[rn].Types {
+				target := s.Definitions[t.Type]
+				if target == nil {
+					return fmt.Errorf("%s#%s: unknown type %q", dn, rn, t.Type)
+				}
+				if t.Relation != "" && target.Relations[t.Relation] == nil && target.Permissions[t.Relation] == nil {
+					return fmt.Errorf("%s#%s: %s has no relation or permission %q", dn, rn, t.Type, t.Relation)
+				}
+				if t.Caveat != "" && s.Caveats[t.Caveat] == nil {
+					return fmt.Errorf("%s#%s: unknown caveat %q", dn, rn, t.Caveat)
+				}
+			}
+		}
+		for _, pn := range d.PermissionOrder {
+			if err := s.checkExpr(d, d.Permissions[pn].Expr); err != nil {
+				return fmt.Errorf("%s#%s: %w", dn, pn, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) checkExpr(d *Definition, e PermExpr) error {
+	switch e := e.(type) {
+	case *RefExpr:
+		if d.Relations[e.Name] == nil && d.Permissions[e.Name] == nil {
+			return fmt.Errorf("unknown relation or permission %q", e.Name)
+		}
+	case *ArrowExpr:
+		rel := d.Relations[e.Relation]
+		if rel == nil {
+			return fmt.Errorf("arrow over unknown relation %q", e.Relation)
+		}
+		found := false
+		for _, t := range rel.Types {
+			if td := s.Definitions[t.Type]; td != nil && (td.Relations[e.Target] != nil || td.Permissions[e.Target] != nil) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no type reachable through %q defines %q", e.Relation, e.Target)
+		}
+	case *BinaryExpr:
+		if err := s.checkExpr(d, e.Left); err != nil {
+			return err
+		}
+		return s.checkExpr(d, e.Right)
+	}
+	return nil
+}
+
+// ----------------- lexer -----------------
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokPunct
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of schema"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type schemaParser struct {
+	src string
+	off int
+	tok token
+}
+
+func (p *schemaParser) position(off int) (int, int) {
+	line, col := 1, 1
+	for i := 0; i < off && i < len(p.src); i++ {
+		if p.src[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+func (p *schemaParser) errorf(format string, args ...interface{}) error {
+	line, col := p.position(p.tok.pos)
+	return &SchemaError{Line: line, Col: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *schemaParser) skipSpaceAndComments() {
+	for p.off < len(p.src) {
+		c := p.src[p.off]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.off++
+		case strings.HasPrefix(p.src[p.off:], "//"):
+			for p.off < len(p.src) && p.src[p.off] != '\n' {
+				p.off++
+			}
+		case strings.HasPrefix(p.src[p.off:], "/*"):
+			end := strings.Index(p.src[p.off+2:], "*/")
+			if end < 0 {
+				p.off = len(p.src)
+			} else {
+				p.off += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '/' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *schemaParser) advance() {
+	p.skipSpaceAndComments()
+	if p.off >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: len(p.src)}
+		return
+	}
+	start := p.off
+	if isIdentByte(p.src[p.off]) {
+		for p.off < len(p.src) && isIdentByte(p.src[p.off]) {
+			p.off++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.off], pos: start}
+		return
+	}
+	if strings.HasPrefix(p.src[p.off:], "->") {
+		p.off += 2
+		p.tok = token{kind: tokPunct, text: "->", pos: start}
+		return
+	}
+	p.off++
+	p.tok = token{kind: tokPunct, text: p.src[start:p.off], pos: start}
+}
+
+func (p *schemaParser) isIdent(text string) bool {
+	return p.tok.kind == tokIdent && p.tok.text == text
+}
+
+func (p *schemaParser) isPunct(text string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == text
+}
+
+func (p *schemaParser) expectPunct(text string) error {
+	if !p.isPunct(text) {
+		return p.errorf("expected %q, found %s", text, p.tok)
+	}
+	p.advance()
+	return nil
+}
+
+func (p *schemaParser) expectIdent() (string, error) {
+	if p.tok.kind != tokIdent {
+		return "", p.errorf("expected identifier, found %s", p.tok)
+	}
+	name := p.tok.text
+	p.advance()
+	return name, nil
+}
+
+// ----------------- parser -----------------
+
+func (p *schemaParser) parseDefinition() (*Definition, error) {
+	p.advance() // "definition"
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	d := &Definition{
+		Name:        name,
+		Relations:   map[string]*RelationDef{},
+		Permissions: map[string]*PermissionDef{},
+	}
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	for !p.isPunct("}") {
+		switch {
+		case p.isIdent("relation"):
+			r, err := p.parseRelation()
+			if err != nil {
+				return nil, err
+			}
+			if d.Relations[r.Name] != nil || d.Permissions[r.Name] != nil {
+				return nil, p.errorf("%s: duplicate name %q", name, r.Name)
+			}
+			d.Relations[r.Name] = r
+			d.RelationOrder = append(d.RelationOrder, r.Name)
+		case p.isIdent("permission"):
+			perm, err := p.parsePermission()
+			if err != nil {
+				return nil, err
+			}
+			if d.Relations[perm.Name] != nil || d.Permissions[perm.Name] != nil {
+				return nil, p.errorf("%s: duplicate name %q", name, perm.Name)
+			}
+			d.Permissions[perm.Name] = perm
+			d.PermissionOrder = append(d.PermissionOrder, perm.Name)
+		default:
+			return nil, p.errorf("expected relation, permission or '}' in %s, found %s", name, p.tok)
+		}
+	}
+	p.advance() // "}"
+	return d, nil
+}
+
+func (p *schemaParser) parseRelation() (*RelationDef, error) {
+	p.advance() // "relation"
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct(":"); err != nil {
+		return nil, err
+	}
+	r := &RelationDef{Name: name}
+	for {
+		t, err := p.parseSubjectType()
+		if err != nil {
+			return nil, err
+		}
+		r.Types = append(r.Types, t)
+		if !p.isPunct("|") {
+			return r, nil
+		}
+		p.advance()
+	}
+}
+
+func (p *schemaParser) parseSubjectType() (SubjectType, error) {
+	var t SubjectType
+	typ, err := p.expectIdent()
+	if err != nil {
+		return t, err
+	}
+	t.Type = typ
+	switch {
+	case p.isPunct(":"):
+		p.advance()
+		if err := p.expectPunct("*"); err != nil {
+			return t, err
+		}
+		t.Wildcard = true
+	case p.isPunct("#"):
+		p.advance()
+		if t.Relation, err = p.expectIdent(); err != nil {
+			return t, err
+		}
+	}
+	if p.isIdent("with") {
+		p.advance()
+		for {
+			trait, err := p.expectIdent()
+			if err != nil {
+				return t, err
+			}
+			if trait == "expiration" {
+				t.Expiration = true
+			} else if t.Caveat == "" {
+				t.Caveat = trait
+			} else {
+				return t, p.errorf("only one caveat allowed per subject type")
+			}
+			if !p.isIdent("and") {
+				break
+			}
+			p.advance()
+		}
+	}
+	return t, nil
+}
+
+func (p *schemaParser) parsePermission() (*PermissionDef, error) {
+	p.advance() // "permission"
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct("="); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	return &PermissionDef{Name: name, Expr: expr}, nil
+}
+
+// Operator precedence, loosest first: exclusion, intersection, union. Arrows
+// bind tighter than all three.
+var permOps = []string{"-", "&", "+"}
+
+func (p *schemaParser) parseExpr(level int) (PermExpr, error) {
+	if level == len(permOps) {
+		return p.parsePrimary()
+	}
+	left, err := p.parseExpr(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct(permOps[level]) {
+		op := permOps[level][0]
+		p.advance()
+		right, err := p.parseExpr(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *schemaParser) parsePrimary() (PermExpr, error) {
+	if p.isPunct("(") {
+		p.advance()
+		e, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if name == "nil" {
+		return &NilExpr{}, nil
+	}
+	if p.isPunct("->") {
+		p.advance()
+		target, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &ArrowExpr{Relation: name, Target: target}, nil
+	}
+	return &RefExpr{Name: name}, nil
+}
+
+func (p *schemaParser) parseCaveat() (*CaveatDef, error) {
+	p.advance() // "caveat"
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	c := &CaveatDef{Name: name}
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	for !p.isPunct(")") {
+		pname, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		ptype, err := p.parseCaveatType()
+		if err != nil {
+			return nil, err
+		}
+		c.Params = append(c.Params, CaveatParam{Name: pname, Type: ptype})
+		if p.isPunct(",") {
+			p.advance()
+		} else if !p.isPunct(")") {
+			return nil, p.errorf("expected ',' or ')' in caveat %s, found %s", name, p.tok)
+		}
+	}
+	p.advance() // ")"
+	if !p.isPunct("{") {
+		return nil, p.errorf("expected '{' after caveat %s parameters, found %s", name, p.tok)
+	}
+
+	// The body is a CEL expression; take it verbatim up to the matching brace.
+	start, depth := p.off, 1
+	for p.off < len(p.src) && depth > 0 {
+		switch p.src[p.off] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"', '\'':
+			q := p.src[p.off]
+			for p.off++; p.off < len(p.src) && p.src[p.off] != q; p.off++ {
+				if p.src[p.off] == '\\' {
+					p.off++
+				}
+			}
+		}
+		p.off++
+	}
+	if depth > 0 {
+		return nil, p.errorf("unterminated caveat %s", name)
+	}
+	bodyPos := start
+	c.Expression = strings.TrimSpace(p.src[start : p.off-1])
+	p.advance()
+
+	expr, err := parseCaveatExpr(c.Expression)
+	if err != nil {
+		line, col := p.position(bodyPos)
+		return nil, &SchemaError{Line: line, Col: col, Msg: fmt.Sprintf("caveat %s: %v", name, err)}
+	}
+	c.expr = expr
+	return c, nil
+}
+
+func (p *schemaParser) parseCaveatType() (string, error) {
+	typ, err := p.expectIdent()
+	if err != nil {
+		return "", err
+	}
+	if !p.isPunct("<") {
+		return typ, nil
+	}
+	p.advance()
+	var args []string
+	for {
+		arg, err := p.parseCaveatType()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+		if !p.isPunct(",") {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expectPunct(">"); err != nil {
+		return "", err
+	}
+	return typ + "<" + strings.Join(args, ", ") + ">", nil
+}
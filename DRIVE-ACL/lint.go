@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/authz"
+)
+
+// runLint implements "lint [flags] FILE...": it prints the findings for each
+// JSON or YAML config and fails when any reaches -fail-on.
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	failOn := fs.String("fail-on", "error", "lowest severity that fails the run: warning or error")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: drive-acl lint [flags] FILE(.json|.yaml)...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	min, err := authz.ParseSeverity(*failOn)
+	if err != nil {
+		return err
+	}
+
+	src, err := schemaSource()
+	if err != nil {
+		return err
+	}
+	zed, err := authz.ParseSchema(src)
+	if err != nil {
+		return err
+	}
+	translator := authz.NewTranslator(zed)
+
+	failed := 0
+	for _, file := range fs.Args() {
+		doc, err := authz.LoadConfigDocument(file)
+		if err != nil {
+			return err
+		}
+		findings := translator.Lint(doc)
+		for _, f := range findings {
+			fmt.Printf("%s: %s\n", file, f)
+		}
+		failed += len(authz.FindingsAtLeast(findings, min))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d finding(s) at %s or above", failed, min)
+	}
+	return nil
+}
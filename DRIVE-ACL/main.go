@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/authz"
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
 )
 
 type SubjectsResponse struct {
@@ -14,6 +22,50 @@ type SubjectsResponse struct {
 	Error    string   `json:"error,omitempty"`
 }
 
+// statusClientClosedRequest is nginx's non-standard status for a request the
+// client abandoned before the response was ready.
+const statusClientClosedRequest = 499
+
+// errorStatus maps an authz error to the HTTP status the caller should see.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, authz.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, authz.ErrInvalidArgument), errors.Is(err, authz.ErrSchemaMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, authz.ErrAlreadyExists), errors.Is(err, authz.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, authz.ErrCanceled):
+		return statusClientClosedRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Clients send back the ZedToken they got from a write in X-Zed-Token so that
+// follow-up reads are at least as fresh as that write. X-Consistency can force
+// minimize_latency or fully_consistent instead.
+const (
+	zedTokenHeader    = "X-Zed-Token"
+	consistencyHeader = "X-Consistency"
+)
+
+// consistencyMiddleware turns the consistency headers into a request context
+// that authz reads honour.
+func consistencyMiddleware(c *gin.Context) {
+	mode, token := c.GetHeader(consistencyHeader), c.GetHeader(zedTokenHeader)
+	if mode == "" && token == "" {
+		c.Next()
+		return
+	}
+	cons, err := authz.ParseConsistency(mode, token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Request = c.Request.WithContext(authz.WithConsistency(c.Request.Context(), cons))
+	c.Next()
+}
+
 // inside authz/handlers.go
 func DirectSubjectsHandlerGin(c *gin.Context) {
 	resourceType := c.Query("resourceType")
@@ -21,9 +73,9 @@ func DirectSubjectsHandlerGin(c *gin.Context) {
 	relation := c.Query("relation")
 	subjectType := c.Query("subjectType")
 
-	subjects, err := authz.GetDirectSubjects(resourceType, resourceID, relation, subjectType)
+	subjects, err := authz.GetDirectSubjectsContext(c.Request.Context(), resourceType, resourceID, relation, subjectType)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(200, gin.H{"subjects": subjects})
@@ -35,42 +87,317 @@ func EffectiveSubjectsHandlerGin(c *gin.Context) {
 	permission := c.Query("permission")
 	subjectType := c.Query("subjectType")
 
-	subjects, err := authz.GetEffectiveSubjects(resourceType, resourceID, permission, subjectType)
+	subjects, err := authz.GetEffectiveSubjectsContext(c.Request.Context(), resourceType, resourceID, permission, subjectType)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(200, gin.H{"subjects": subjects})
 }
 
+// connectFromEnv builds the SpiceDB connection from SPICEDB_* environment
+// variables. Without SPICEDB_CA_CERT or SPICEDB_TLS=true it talks plaintext to
+// a local dev instance. SPICEDB_ADDR=memory runs against the in-process
+// evaluator instead; the schema reaches it through syncSchema like any other.
+func connectFromEnv() (*authz.Authorizer, error) {
+	addr := envOr("SPICEDB_ADDR", "localhost:50051")
+	if addr == "memory" {
+		log.Printf("using in-memory SpiceDB; data is lost on exit")
+		return authz.NewAuthorizer(authz.NewMemoryClient(nil)), nil
+	}
+	opts := []authz.ClientOption{authz.WithKeepalive(30*time.Second, 10*time.Second)}
+
+	useTLS := os.Getenv("SPICEDB_CA_CERT") != "" || os.Getenv("SPICEDB_TLS") == "true"
+	switch {
+	case os.Getenv("SPICEDB_TOKEN_FILE") != "":
+		opts = append(opts, authz.WithTokenFile(os.Getenv("SPICEDB_TOKEN_FILE")))
+	case os.Getenv("SPICEDB_TOKEN") != "":
+		opts = append(opts, authz.WithTokenEnv("SPICEDB_TOKEN"))
+	case useTLS:
+		return nil, errors.New("SPICEDB_TOKEN or SPICEDB_TOKEN_FILE is required with TLS")
+	default:
+		opts = append(opts, authz.WithToken("devkey")) // local dev instance only
+	}
+
+	if useTLS {
+		ca := os.Getenv("SPICEDB_CA_CERT")
+		if ca != "" {
+			opts = append(opts, authz.WithCACert(ca))
+		}
+		if cert := os.Getenv("SPICEDB_CLIENT_CERT"); cert != "" {
+			opts = append(opts, authz.WithClientCert(cert, os.Getenv("SPICEDB_CLIENT_KEY")))
+		}
+		if name := os.Getenv("SPICEDB_SERVER_NAME"); name != "" {
+			opts = append(opts, authz.WithServerName(name))
+		}
+	} else {
+		opts = append(opts, authz.WithInsecure())
+	}
+
+	if v := os.Getenv("SPICEDB_DIAL_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPICEDB_DIAL_TIMEOUT %q: %w", v, err)
+		}
+		opts = append(opts, authz.WithDialTimeout(d))
+	}
+	if v := os.Getenv("SPICEDB_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPICEDB_TIMEOUT %q: %w", v, err)
+		}
+		opts = append(opts, authz.WithAuthorizerOptions(authz.WithTimeout(d)))
+	}
+	return authz.Connect(addr, opts...)
+}
+
+// schemaSource returns the embedded schema, or the file named by
+// SPICEDB_SCHEMA when set.
+func schemaSource() (string, error) {
+	path := os.Getenv("SPICEDB_SCHEMA")
+	if path == "" {
+		return schema.Zed, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read SPICEDB_SCHEMA: %w", err)
+	}
+	return string(b), nil
+}
+
+// syncSchema writes src to SpiceDB when it is missing or outdated.
+// SPICEDB_SCHEMA_POLICY=refuse|warn decides what happens when the change
+// would orphan relationships, and SPICEDB_SCHEMA_SYNC=false skips the step.
+func syncSchema(az *authz.Authorizer, src string) error {
+	if os.Getenv("SPICEDB_SCHEMA_SYNC") == "false" {
+		return nil
+	}
+	policy, err := authz.ParseOrphanPolicy(envOr("SPICEDB_SCHEMA_POLICY", "refuse"))
+	if err != nil {
+		return err
+	}
+
+	plan, err := az.SyncSchema(context.Background(), src, policy)
+	if plan != nil && !plan.Diff.Empty() {
+		log.Printf("schema diff against SpiceDB:\n%s", plan.Diff)
+	}
+	if err != nil {
+		return err
+	}
+	if plan.Applied {
+		log.Printf("schema written at %s", plan.WrittenAt)
+	}
+	return nil
+}
+
+// translateConfig turns a config payload into relationships, rejecting it as
+// a whole if it is malformed or any relationship does not fit the schema.
+func translateConfig(zed *authz.Schema, body map[string]interface{}) ([]authz.Relationship, error) {
+	translated, err := checkConfig(zed, body)
+	if err != nil {
+		return nil, err
+	}
+	rels := make([]authz.Relationship, len(translated))
+	for i, tr := range translated {
+		rels[i] = tr.Relationship
+	}
+	return rels, nil
+}
+
+// checkConfig translates body with the schema the service runs on, so new
+// definitions in schema.zed are configurable without code changes.
+func checkConfig(zed *authz.Schema, body map[string]interface{}) ([]authz.TranslatedRelationship, error) {
+	translated, err := authz.NewTranslator(zed).Translate(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := zed.ValidateTranslation(translated); err != nil {
+		return nil, err
+	}
+	return translated, nil
+}
+
+// configError answers a rejected /init or /add payload, listing each
+// offending config path when decoding or the schema check failed.
+func configError(c *gin.Context, err error) {
+	var cerr *authz.ConfigError
+	if errors.As(err, &cerr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid config", "problems": cerr.Problems})
+		return
+	}
+	var verr *authz.ValidationError
+	if errors.As(err, &verr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "config does not match the schema", "problems": verr.Problems})
+		return
+	}
+	c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+}
+
+// explainLink is the /explain URL for a check.
+func explainLink(resource authz.ObjectReference, permission string, subject authz.SubjectReference) string {
+	q := url.Values{"resource": {resource.String()}, "permission": {permission}, "subject": {subject.String()}}
+	return "/explain?" + q.Encode()
+}
+
+// queryList splits a comma-separated query parameter such as
+// ?permissions=view,admin; it is nil when the parameter is absent.
+func queryList(c *gin.Context, key string) []string {
+	var out []string
+	for _, v := range strings.Split(c.Query(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			log.Fatalf("import failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		if err := runLint(os.Args[2:]); err != nil {
+			log.Fatalf("lint failed: %v", err)
+		}
+		return
+	}
+
 	// init SpiceDB client
-	authz.InitClient("localhost:50051", "devkey")
+	az, err := connectFromEnv()
+	if err != nil {
+		log.Fatalf("failed to init SpiceDB client: %v", err)
+	}
+	defer az.Close()
+	authz.SetDefault(az)
+	if err := az.Ready(context.Background()); err != nil {
+		log.Printf("SpiceDB not ready yet: %v", err)
+	}
+	src, err := schemaSource()
+	if err != nil {
+		log.Fatalf("failed to load schema: %v", err)
+	}
+	zed, err := authz.ParseSchema(src)
+	if err != nil {
+		log.Fatalf("failed to parse schema: %v", err)
+	}
+	if err := syncSchema(az, src); err != nil {
+		if !errors.Is(err, authz.ErrUnavailable) {
+			log.Fatalf("schema sync failed: %v", err)
+		}
+		log.Printf("schema sync skipped, SpiceDB unavailable: %v", err)
+	}
 
+	batchSize, err := strconv.Atoi(envOr("SPICEDB_BATCH_SIZE", strconv.Itoa(authz.DefaultBatchSize)))
+	if err != nil {
+		log.Fatalf("invalid SPICEDB_BATCH_SIZE: %v", err)
+	}
+	// LINT_GATE=error|warning makes /init refuse configs with lint findings
+	// at that severity or above.
+	var lintGate *authz.Severity
+	if v := os.Getenv("LINT_GATE"); v != "" {
+		min, err := authz.ParseSeverity(v)
+		if err != nil {
+			log.Fatalf("invalid LINT_GATE: %v", err)
+		}
+		lintGate = &min
+	}
+
+	newRouter(az, zed, batchSize, lintGate).Run(":8082")
+}
+
+// newRouter registers the HTTP API. Handlers go through the default
+// Authorizer (see authz.SetDefault); az is asked for readiness. Configs are
+// translated against zed, /init loads in batches of batchSize and, when
+// lintGate is set, refuses configs with findings at that severity or above.
+func newRouter(az *authz.Authorizer, zed *authz.Schema, batchSize int, lintGate *authz.Severity) *gin.Engine {
 	r := gin.Default()
+	r.Use(consistencyMiddleware)
 
+	// /check asks about users:<user> by default; subject_type, subject_id and
+	// subject_relation ask about any other subject, e.g. roles:admin#user.
 	r.POST("/check", func(c *gin.Context) {
-		var body struct {
-			User       string `json:"user"`
-			ObjectID   string `json:"object_id"`
-			ObjectType string `json:"object_type"`
-			Permission string `json:"permission"`
-		}
+		var body authz.CheckItem
 		if err := c.ShouldBindJSON(&body); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		allowed := authz.Check(body.User, body.ObjectType, body.ObjectID, body.Permission)
-		c.JSON(200, gin.H{"allowed": allowed})
+		res, err := authz.CheckSubjectWithCaveatContext(c.Request.Context(), body.Resource(), body.Permission, body.Subject(), body.Context)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !res.Allowed() {
+			c.JSON(http.StatusForbidden, gin.H{"allowed": false, "permissionship": res.Permissionship, "missing_context": res.Missing,
+				"explain": explainLink(body.Resource(), body.Permission, body.Subject())})
+			return
+		}
+		c.JSON(200, gin.H{"allowed": true, "permissionship": res.Permissionship})
+	})
+
+	// /explain?resource=advertiser:123&permission=view&subject=users:alice
+	// says why the check comes out as it does; user=alice is short for
+	// subject=users:alice. /check links here from its 403s.
+	r.GET("/explain", func(c *gin.Context) {
+		resource, err := authz.ParseObjectReference(c.Query("resource"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resource: " + err.Error()})
+			return
+		}
+		subject := authz.User(c.Query("user"))
+		if s := c.Query("subject"); s != "" {
+			if subject, err = authz.ParseSubjectReference(s); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "subject: " + err.Error()})
+				return
+			}
+		}
+		ex, err := authz.ExplainContext(c.Request.Context(), resource, c.Query("permission"), subject, nil)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"explanation": ex.String(), "details": ex})
+	})
+
+	// /check/bulk takes an array of /check bodies and answers each, in order.
+	// A check that fails on its own gets an "error" instead of failing the
+	// request.
+	r.POST("/check/bulk", func(c *gin.Context) {
+		var items []authz.CheckItem
+		if err := c.ShouldBindJSON(&items); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		results, err := authz.CheckBulkContext(c.Request.Context(), items)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"results": results})
 	})
 
+	// The hierarchy endpoints take ?permissions=view,admin,... and annotate
+	// every node with the subject's result for each, in bulk.
 	r.GET("/lookup/:resourceType/:permission/:subjectType/:subjectID", func(c *gin.Context) {
 		resourceType := c.Param("resourceType")
 		permission := c.Param("permission")
 		subjectType := c.Param("subjectType")
 		subjectID := c.Param("subjectID")
 
-		hierarchy := authz.ListResourceHierarchy(resourceType, permission, subjectType, subjectID)
+		hierarchy, err := authz.ListResourceHierarchyContext(c.Request.Context(), resourceType, permission, subjectType, subjectID, queryList(c, "permissions")...)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(200, gin.H{
 			"subject":    map[string]string{"type": subjectType, "id": subjectID},
 			"resource":   resourceType,
@@ -85,9 +412,62 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		rels := authz.Translate(body)
-		authz.LoadRelationships(rels)
-		c.JSON(200, gin.H{"loaded": rels})
+		rels, err := translateConfig(zed, body)
+		if err != nil {
+			configError(c, err)
+			return
+		}
+		if lintGate != nil {
+			if findings := authz.FindingsAtLeast(authz.NewTranslator(zed).Lint(body), *lintGate); len(findings) > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "config failed lint", "findings": findings})
+				return
+			}
+		}
+		// Large configs go out in chunks; chunks written before a failure stay,
+		// and re-posting the same config is safe.
+		result, err := authz.BulkLoadContext(c.Request.Context(), rels, authz.BulkOptions{BatchSize: batchSize})
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error(), "result": result})
+			return
+		}
+		c.Header(zedTokenHeader, result.WrittenAt)
+		c.JSON(200, gin.H{"loaded": rels, "zed_token": result.WrittenAt, "chunks": result.Chunks})
+	})
+
+	// Report policy mistakes in a config, e.g. a user both granted and denied.
+	// Findings never block this endpoint; see LINT_GATE for /init.
+	r.POST("/lint", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"findings": authz.NewTranslator(zed).Lint(body)})
+	})
+
+	// Preview what a config turns into without writing anything.
+	// ?format=grouped groups the relationships by object, ?format=text renders
+	// those groups for code review.
+	r.POST("/translate", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		translated, err := checkConfig(zed, body)
+		if err != nil {
+			configError(c, err)
+			return
+		}
+		switch c.Query("format") {
+		case "grouped":
+			c.JSON(200, gin.H{"objects": authz.GroupByObject(translated)})
+		case "text":
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+			authz.FormatGrouped(c.Writer, authz.GroupByObject(translated))
+		default:
+			c.JSON(200, gin.H{"relationships": translated})
+		}
 	})
 
 	// Add new JSON data into SpiceDB
@@ -97,9 +477,61 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		rels := authz.Translate(body)
-		authz.LoadRelationships(rels)
-		c.JSON(200, gin.H{"added": rels})
+		rels, err := translateConfig(zed, body)
+		if err != nil {
+			configError(c, err)
+			return
+		}
+		result, err := authz.WriteRelationshipsContext(c.Request.Context(), rels)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error(), "result": result})
+			return
+		}
+		c.Header(zedTokenHeader, result.WrittenAt)
+		c.JSON(200, gin.H{"added": rels, "zed_token": result.WrittenAt})
+	})
+
+	// Make SpiceDB match a full config: adds what is new, deletes what the
+	// config no longer mentions. ?dry_run=true only reports the plan;
+	// ?allow_empty=true lets a config with no relationships wipe the types it
+	// owns; ?allow_partial=true lets a plan too big for one write go through
+	// in several.
+	r.POST("/reconcile", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rels, err := translateConfig(zed, body)
+		if err != nil {
+			configError(c, err)
+			return
+		}
+		plan, err := authz.ReconcileContext(c.Request.Context(), rels, authz.ReconcileOptions{
+			DryRun:        c.Query("dry_run") == "true",
+			AllowEmpty:    c.Query("allow_empty") == "true",
+			AllowPartial:  c.Query("allow_partial") == "true",
+			ResourceTypes: authz.NewTranslator(zed).ResourceTypes(),
+		})
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error(), "plan": plan})
+			return
+		}
+		if plan.WrittenAt != "" {
+			c.Header(zedTokenHeader, plan.WrittenAt)
+		}
+		c.JSON(200, plan)
+	})
+
+	// Rebuild the config from what SpiceDB holds now, e.g. after ACLs were
+	// edited with zed. POSTing .config to /reconcile is a no-op.
+	r.GET("/export", func(c *gin.Context) {
+		result, err := authz.ExportContext(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, result)
 	})
 
 	r.GET("/subtree/:rootType/:rootID/:permission", func(c *gin.Context) {
@@ -110,7 +542,11 @@ func main() {
 		subjectID := c.Query("subjectID")     // optional
 		targetType := c.Query("targetType")   // optional
 
-		tree := authz.ListResourceSubtree(rootType, rootID, permission, subjectType, subjectID, targetType)
+		tree, err := authz.ListResourceSubtreeContext(c.Request.Context(), rootType, rootID, permission, subjectType, subjectID, targetType, queryList(c, "permissions")...)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(200, gin.H{
 			"root":       fmt.Sprintf("%s:%s", rootType, rootID),
 			"permission": permission,
@@ -120,6 +556,34 @@ func main() {
 		})
 	})
 
+	// One tree per subject across types: partners, then their advertisers and
+	// publishers, features and APIs. ?levels=partner:view,advertiser:view,...
+	// overrides which types appear and the permission each needs; see above
+	// for ?permissions.
+	r.GET("/tree/:subjectType/:subjectID", func(c *gin.Context) {
+		subjectType := c.Param("subjectType")
+		subjectID := c.Param("subjectID")
+		levels := authz.DefaultTreeLevels
+		if v := c.Query("levels"); v != "" {
+			var err error
+			if levels, err = authz.ParseTreeLevels(v); err != nil {
+				c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		tree, err := authz.ListResourceTreeContext(c.Request.Context(), subjectType, subjectID, levels, queryList(c, "permissions")...)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{
+			"subject": map[string]string{"type": subjectType, "id": subjectID},
+			"levels":  levels,
+			"tree":    tree,
+		})
+	})
+
 	r.GET("/authz/token/:ssoUserId", func(c *gin.Context) {
 
 		ssoUserIdStr := c.Param("ssoUserId")
@@ -139,17 +603,29 @@ func main() {
 			partnerID = &pid
 		}
 
-		token, err := authz.GetAuthorizationTokenDataForSSOUserId(ssoUserId, partnerID)
+		token, err := authz.GetAuthorizationTokenDataForSSOUserIdContext(c.Request.Context(), ssoUserId, partnerID)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			status := errorStatus(err)
+			if status == http.StatusInternalServerError {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(200, token)
 	})
 
+	r.GET("/readyz", func(c *gin.Context) {
+		if err := az.Ready(c.Request.Context()); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ready": true})
+	})
+
 	r.GET("/authz/direct-subjects", DirectSubjectsHandlerGin)
 	r.GET("/authz/effective-subjects", EffectiveSubjectsHandlerGin)
 
-	r.Run(":8082")
+	return r
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/authz"
+	"github.com/lm-Kavya-Veer/drive-acl/DRIVE-ACL/schema"
+)
+
+// testRouter serves the API over a MemoryClient holding rels.
+func testRouter(t *testing.T, rels ...string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	zed, err := authz.ParseSchema(schema.Zed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	az := authz.NewAuthorizer(authz.NewMemoryClient(zed))
+	parsed, errs := authz.ParseRelationships(rels)
+	if len(errs) > 0 {
+		t.Fatalf("parse: %+v", errs)
+	}
+	if _, err := az.WriteRelationships(context.Background(), parsed); err != nil {
+		t.Fatal(err)
+	}
+	authz.SetDefault(az)
+	return newRouter(az, zed, authz.DefaultBatchSize, nil)
+}
+
+func TestCheckRoute(t *testing.T) {
+	r := testRouter(t,
+		"partner:p#user@users:alice",
+		"publisher:b#role@roles:admin",
+	)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "legacy user field", body: `{"user": "alice", "object_type": "partner", "object_id": "p", "permission": "view"}`, want: http.StatusOK},
+		{name: "legacy user field denied", body: `{"user": "bob", "object_type": "partner", "object_id": "p", "permission": "view"}`, want: http.StatusForbidden},
+		{name: "subject fields", body: `{"subject_type": "users", "subject_id": "alice", "object_type": "partner", "object_id": "p", "permission": "view"}`, want: http.StatusOK},
+		{name: "subject relation", body: `{"subject_type": "roles", "subject_id": "admin", "subject_relation": "user", "object_type": "publisher", "object_id": "b", "permission": "admin"}`, want: http.StatusOK},
+		{name: "unknown permission", body: `{"user": "alice", "object_type": "partner", "object_id": "p", "permission": "nope"}`, want: http.StatusBadRequest},
+		{name: "not JSON", body: `user=alice`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/check", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got struct {
+				Allowed bool `json:"allowed"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || !got.Allowed {
+				t.Errorf("body = %s, want allowed", w.Body)
+			}
+		})
+	}
+}
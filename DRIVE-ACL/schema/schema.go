@@ -0,0 +1,9 @@
+// Package schema embeds the SpiceDB schema this service is written against.
+package schema
+
+import _ "embed"
+
+// Zed is the contents of schema.zed.
+//
+//go:embed schema.zed
+var Zed string